@@ -0,0 +1,387 @@
+/*
+Copyright 2020 The argocd-clusterset authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+)
+
+// annotationKeySelector marks the v1beta1 ClusterSet whose first selector was converted from spec.selector of v1alpha1,
+// so that it's converted back to spec.selector rather than spec.selectors
+const annotationKeySelector = "clusterset.mumo.co/v1alpha1-selector"
+
+// annotationKeyImplicitMatchAll marks the v1beta1 ClusterSet converted from a v1alpha1 one without any selector,
+// which v1alpha1 treats as all the EKS clusters, so that matchAll is converted back to false
+const annotationKeyImplicitMatchAll = "clusterset.mumo.co/v1alpha1-implicit-match-all"
+
+var _ conversion.Convertible = &ClusterSet{}
+
+// ConvertTo converts this ClusterSet to the hub version v1beta1
+func (src *ClusterSet) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.ClusterSet)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	if !src.Spec.Selector.IsEmpty() {
+		dst.Spec.Selectors = append(dst.Spec.Selectors, convertSelectorTo(src.Spec.Selector))
+
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+
+		dst.Annotations[annotationKeySelector] = "true"
+	}
+
+	for _, sel := range src.Spec.Selectors {
+		dst.Spec.Selectors = append(dst.Spec.Selectors, convertSelectorTo(sel))
+	}
+
+	if src.Spec.Exclude != nil {
+		exclude := convertSelectorTo(*src.Spec.Exclude)
+		dst.Spec.Exclude = &exclude
+	}
+
+	dst.Spec.MatchAll = src.Spec.MatchAll
+
+	// v1beta1 refuses to sync a ClusterSet without selectors unless matchAll is set, while v1alpha1 syncs all the EKS clusters
+	if !src.Spec.MatchAll && len(dst.Spec.Selectors) == 0 {
+		dst.Spec.MatchAll = true
+
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+
+		dst.Annotations[annotationKeyImplicitMatchAll] = "true"
+	}
+
+	dst.Spec.Template = v1beta1.ClusterSecretTemplate{
+		Metadata: v1beta1.ClusterSecretTemplateMetadata{
+			Labels: src.Spec.Template.Metadata.Labels,
+		},
+		NameStrategy: src.Spec.Template.NameStrategy,
+		NamePrefix:   src.Spec.Template.NamePrefix,
+	}
+
+	if e := src.Spec.Template.EndpointAccess; e != nil {
+		access := v1beta1.EndpointAccessSpec(*e)
+		dst.Spec.Template.EndpointAccess = &access
+	}
+	dst.Spec.RefreshInterval = src.Spec.RefreshInterval
+	dst.Spec.Suspend = src.Spec.Suspend
+	dst.Spec.Priority = src.Spec.Priority
+	dst.Spec.TargetNamespaces = src.Spec.TargetNamespaces
+
+	if p := src.Spec.Prune; p != nil {
+		prune := v1beta1.PruneSpec(*p)
+		dst.Spec.Prune = &prune
+	}
+
+	if r := src.Spec.Rollout; r != nil {
+		rollout := v1beta1.RolloutSpec(*r)
+		dst.Spec.Rollout = &rollout
+	}
+
+	for _, d := range src.Spec.Destinations {
+		dest := v1beta1.ClusterSetDestination{Namespace: d.Namespace}
+
+		if d.KubeconfigSecretRef != nil {
+			dest.KubeconfigSecretRef = &v1beta1.SecretReference{Name: d.KubeconfigSecretRef.Name}
+		}
+
+		dst.Spec.Destinations = append(dst.Spec.Destinations, dest)
+	}
+
+	if c := src.Spec.ConnectivityCheck; c != nil {
+		check := v1beta1.ConnectivityCheckSpec(*c)
+		dst.Spec.ConnectivityCheck = &check
+	}
+
+	dst.Status = convertStatusTo(src.Status)
+
+	return nil
+}
+
+// ConvertFrom converts the hub version v1beta1 to this ClusterSet
+func (dst *ClusterSet) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.ClusterSet)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	selectors := src.Spec.Selectors
+
+	dst.Spec.MatchAll = src.Spec.MatchAll
+
+	if _, ok := dst.Annotations[annotationKeyImplicitMatchAll]; ok {
+		delete(dst.Annotations, annotationKeyImplicitMatchAll)
+
+		dst.Spec.MatchAll = false
+	}
+
+	if _, ok := dst.Annotations[annotationKeySelector]; ok {
+		delete(dst.Annotations, annotationKeySelector)
+
+		if len(selectors) > 0 {
+			dst.Spec.Selector = convertSelectorFrom(selectors[0])
+			selectors = selectors[1:]
+		}
+	}
+
+	for _, sel := range selectors {
+		dst.Spec.Selectors = append(dst.Spec.Selectors, convertSelectorFrom(sel))
+	}
+
+	if src.Spec.Exclude != nil {
+		exclude := convertSelectorFrom(*src.Spec.Exclude)
+		dst.Spec.Exclude = &exclude
+	}
+
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	dst.Spec.Template = ClusterSecretTemplate{
+		Metadata: ClusterSecretTemplateMetadata{
+			Labels: src.Spec.Template.Metadata.Labels,
+		},
+		NameStrategy: src.Spec.Template.NameStrategy,
+		NamePrefix:   src.Spec.Template.NamePrefix,
+	}
+
+	if e := src.Spec.Template.EndpointAccess; e != nil {
+		access := EndpointAccessSpec(*e)
+		dst.Spec.Template.EndpointAccess = &access
+	}
+	dst.Spec.RefreshInterval = src.Spec.RefreshInterval
+	dst.Spec.Suspend = src.Spec.Suspend
+	dst.Spec.Priority = src.Spec.Priority
+	dst.Spec.TargetNamespaces = src.Spec.TargetNamespaces
+
+	if p := src.Spec.Prune; p != nil {
+		prune := PruneSpec(*p)
+		dst.Spec.Prune = &prune
+	}
+
+	if r := src.Spec.Rollout; r != nil {
+		rollout := RolloutSpec(*r)
+		dst.Spec.Rollout = &rollout
+	}
+
+	for _, d := range src.Spec.Destinations {
+		dest := ClusterSetDestination{Namespace: d.Namespace}
+
+		if d.KubeconfigSecretRef != nil {
+			dest.KubeconfigSecretRef = &SecretReference{Name: d.KubeconfigSecretRef.Name}
+		}
+
+		dst.Spec.Destinations = append(dst.Spec.Destinations, dest)
+	}
+
+	if c := src.Spec.ConnectivityCheck; c != nil {
+		check := ConnectivityCheckSpec(*c)
+		dst.Spec.ConnectivityCheck = &check
+	}
+
+	dst.Status = convertStatusFrom(src.Status)
+
+	return nil
+}
+
+// convertSelectorTo converts the selector into the v1beta1 one, where the EKS criteria are moved into the eks block.
+// The eks block is set whenever either of the EKS criteria is set, or no other provider is, as EKS is the default.
+func convertSelectorTo(src ClusterSelector) v1beta1.ClusterSelector {
+	var dst v1beta1.ClusterSelector
+
+	if len(src.EKSTags) > 0 || src.EKSRegion != "" || src.EKSRoleARN != "" || (src.HTTP == nil && src.OCM == nil && src.Karmada == nil) {
+		dst.EKS = &v1beta1.EKSClusterSelector{
+			Tags:    src.EKSTags,
+			Region:  src.EKSRegion,
+			RoleARN: src.EKSRoleARN,
+		}
+	}
+
+	if h := src.HTTP; h != nil {
+		dst.HTTP = &v1beta1.HTTPClusterSelector{
+			URL:       h.URL,
+			ItemsPath: h.ItemsPath,
+			NextPath:  h.NextPath,
+			Fields: v1beta1.HTTPClusterFields{
+				Name:           h.Fields.Name,
+				Server:         h.Fields.Server,
+				CAData:         h.Fields.CAData,
+				AWSClusterName: h.Fields.AWSClusterName,
+				BearerToken:    h.Fields.BearerToken,
+				Labels:         h.Fields.Labels,
+			},
+			MatchLabels: h.MatchLabels,
+		}
+
+		if h.AuthSecretRef != nil {
+			dst.HTTP.AuthSecretRef = &v1beta1.SecretReference{Name: h.AuthSecretRef.Name}
+		}
+	}
+
+	if o := src.OCM; o != nil {
+		dst.OCM = &v1beta1.OCMClusterSelector{
+			MatchLabels:           o.MatchLabels,
+			ManagedServiceAccount: o.ManagedServiceAccount,
+		}
+
+		if o.HubKubeconfigSecretRef != nil {
+			dst.OCM.HubKubeconfigSecretRef = &v1beta1.SecretReference{Name: o.HubKubeconfigSecretRef.Name}
+		}
+	}
+
+	if k := src.Karmada; k != nil {
+		dst.Karmada = &v1beta1.KarmadaClusterSelector{
+			MatchLabels: k.MatchLabels,
+		}
+
+		if k.HubKubeconfigSecretRef != nil {
+			dst.Karmada.HubKubeconfigSecretRef = &v1beta1.SecretReference{Name: k.HubKubeconfigSecretRef.Name}
+		}
+	}
+
+	return dst
+}
+
+func convertSelectorFrom(src v1beta1.ClusterSelector) ClusterSelector {
+	var dst ClusterSelector
+
+	if e := src.EKS; e != nil {
+		dst.EKSTags = e.Tags
+		dst.EKSRegion = e.Region
+		dst.EKSRoleARN = e.RoleARN
+	}
+
+	if h := src.HTTP; h != nil {
+		dst.HTTP = &HTTPClusterSelector{
+			URL:       h.URL,
+			ItemsPath: h.ItemsPath,
+			NextPath:  h.NextPath,
+			Fields: HTTPClusterFields{
+				Name:           h.Fields.Name,
+				Server:         h.Fields.Server,
+				CAData:         h.Fields.CAData,
+				AWSClusterName: h.Fields.AWSClusterName,
+				BearerToken:    h.Fields.BearerToken,
+				Labels:         h.Fields.Labels,
+			},
+			MatchLabels: h.MatchLabels,
+		}
+
+		if h.AuthSecretRef != nil {
+			dst.HTTP.AuthSecretRef = &SecretReference{Name: h.AuthSecretRef.Name}
+		}
+	}
+
+	if o := src.OCM; o != nil {
+		dst.OCM = &OCMClusterSelector{
+			MatchLabels:           o.MatchLabels,
+			ManagedServiceAccount: o.ManagedServiceAccount,
+		}
+
+		if o.HubKubeconfigSecretRef != nil {
+			dst.OCM.HubKubeconfigSecretRef = &SecretReference{Name: o.HubKubeconfigSecretRef.Name}
+		}
+	}
+
+	if k := src.Karmada; k != nil {
+		dst.Karmada = &KarmadaClusterSelector{
+			MatchLabels: k.MatchLabels,
+		}
+
+		if k.HubKubeconfigSecretRef != nil {
+			dst.Karmada.HubKubeconfigSecretRef = &SecretReference{Name: k.HubKubeconfigSecretRef.Name}
+		}
+	}
+
+	return dst
+}
+
+func convertStatusTo(src ClusterSetStatus) v1beta1.ClusterSetStatus {
+	dst := v1beta1.ClusterSetStatus{
+		Clusters:        v1beta1.ClusterSetStatusClusters(src.Clusters),
+		LastSyncTime:    src.LastSyncTime,
+		Phase:           src.Phase,
+		Reason:          src.Reason,
+		Message:         src.Message,
+		PendingClusters: src.PendingClusters,
+		LastRolloutTime: src.LastRolloutTime,
+		Conditions:      src.Conditions,
+	}
+
+	for _, c := range src.Conflicts {
+		dst.Conflicts = append(dst.Conflicts, v1beta1.ClusterSetConflict(c))
+	}
+
+	if d := src.Drift; d != nil {
+		drift := v1beta1.ClusterSetDrift(*d)
+		dst.Drift = &drift
+	}
+
+	for _, d := range src.PendingDeletions {
+		dst.PendingDeletions = append(dst.PendingDeletions, v1beta1.ClusterSetPendingDeletion(d))
+	}
+
+	for _, d := range src.Destinations {
+		dst.Destinations = append(dst.Destinations, v1beta1.ClusterSetDestinationStatus(d))
+	}
+
+	for _, c := range src.Connectivity {
+		dst.Connectivity = append(dst.Connectivity, v1beta1.ClusterConnectivityStatus(c))
+	}
+
+	return dst
+}
+
+func convertStatusFrom(src v1beta1.ClusterSetStatus) ClusterSetStatus {
+	dst := ClusterSetStatus{
+		Clusters:        ClusterSetStatusClusters(src.Clusters),
+		LastSyncTime:    src.LastSyncTime,
+		Phase:           src.Phase,
+		Reason:          src.Reason,
+		Message:         src.Message,
+		PendingClusters: src.PendingClusters,
+		LastRolloutTime: src.LastRolloutTime,
+		Conditions:      src.Conditions,
+	}
+
+	for _, c := range src.Conflicts {
+		dst.Conflicts = append(dst.Conflicts, ClusterSetConflict(c))
+	}
+
+	if d := src.Drift; d != nil {
+		drift := ClusterSetDrift(*d)
+		dst.Drift = &drift
+	}
+
+	for _, d := range src.PendingDeletions {
+		dst.PendingDeletions = append(dst.PendingDeletions, ClusterSetPendingDeletion(d))
+	}
+
+	for _, d := range src.Destinations {
+		dst.Destinations = append(dst.Destinations, ClusterSetDestinationStatus(d))
+	}
+
+	for _, c := range src.Connectivity {
+		dst.Connectivity = append(dst.Connectivity, ClusterConnectivityStatus(c))
+	}
+
+	return dst
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The argocd-clusterset authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+)
+
+func TestConvertRoundTripFromV1alpha1(t *testing.T) {
+	maxDeletions := intstr.FromString("10%")
+
+	testcases := map[string]ClusterSet{
+		"no selector": {
+			ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "argocd"},
+			Spec: ClusterSetSpec{
+				Template: ClusterSecretTemplate{NameStrategy: "plain"},
+			},
+		},
+		"match all": {
+			ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "argocd"},
+			Spec: ClusterSetSpec{
+				MatchAll: true,
+			},
+		},
+		"selector": {
+			ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "argocd", Annotations: map[string]string{"foo": "bar"}},
+			Spec: ClusterSetSpec{
+				Selector: ClusterSelector{
+					EKSTags:    map[string]string{"env": "prod"},
+					EKSRegion:  "us-east-2",
+					EKSRoleARN: "arn:aws:iam::123456789012:role/clusterset",
+				},
+				Template: ClusterSecretTemplate{
+					Metadata:     ClusterSecretTemplateMetadata{Labels: map[string]string{"env": "prod"}},
+					NameStrategy: "prefixed",
+					NamePrefix:   "eks-",
+				},
+			},
+		},
+		"selector and selectors": {
+			ObjectMeta: metav1.ObjectMeta{Name: "mixed", Namespace: "argocd"},
+			Spec: ClusterSetSpec{
+				Selector: ClusterSelector{EKSTags: map[string]string{"env": "prod"}},
+				Selectors: []ClusterSelector{
+					{
+						HTTP: &HTTPClusterSelector{
+							URL:           "https://inventory.example.com/clusters",
+							ItemsPath:     "items",
+							Fields:        HTTPClusterFields{Name: "name", Server: "server"},
+							AuthSecretRef: &SecretReference{Name: "inventory"},
+						},
+					},
+					{
+						OCM: &OCMClusterSelector{
+							MatchLabels:            map[string]string{"region": "eu"},
+							HubKubeconfigSecretRef: &SecretReference{Name: "hub"},
+							ManagedServiceAccount:  "argocd",
+						},
+					},
+					{
+						Karmada: &KarmadaClusterSelector{MatchLabels: map[string]string{"tier": "edge"}},
+					},
+				},
+				Exclude: &ClusterSelector{EKSTags: map[string]string{"skip": "true"}},
+			},
+		},
+		"selectors": {
+			ObjectMeta: metav1.ObjectMeta{Name: "regions", Namespace: "argocd"},
+			Spec: ClusterSetSpec{
+				Selectors: []ClusterSelector{
+					{EKSRegion: "us-east-2"},
+					{EKSRegion: "eu-west-1"},
+				},
+				RefreshInterval:  &metav1.Duration{Duration: time.Minute},
+				Suspend:          true,
+				Priority:         10,
+				TargetNamespaces: []string{"argocd", "argocd-2"},
+				Prune:            &PruneSpec{MaxDeletions: &maxDeletions},
+				Destinations: []ClusterSetDestination{
+					{Namespace: "argocd", KubeconfigSecretRef: &SecretReference{Name: "remote"}},
+				},
+			},
+			Status: ClusterSetStatus{
+				Phase:           "Synced",
+				PendingClusters: []string{"foo"},
+				Conflicts:       []ClusterSetConflict{{Server: "https://bar", Clusters: []string{"bar", "baz"}}},
+			},
+		},
+	}
+
+	for name, src := range testcases {
+		t.Run(name, func(t *testing.T) {
+			var hub v1beta1.ClusterSet
+
+			if err := src.DeepCopy().ConvertTo(&hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+
+			var got ClusterSet
+
+			if err := got.ConvertFrom(&hub); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+
+			if !equality.Semantic.DeepEqual(src, got) {
+				t.Errorf("unexpected round trip result:\n%s", diff.ObjectReflectDiff(src, got))
+			}
+		})
+	}
+}
+
+func TestConvertRoundTripFromV1beta1(t *testing.T) {
+	testcases := map[string]v1beta1.ClusterSet{
+		"match all": {
+			ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "argocd"},
+			Spec: v1beta1.ClusterSetSpec{
+				MatchAll: true,
+			},
+		},
+		"selectors": {
+			ObjectMeta: metav1.ObjectMeta{Name: "mixed", Namespace: "argocd", Annotations: map[string]string{"foo": "bar"}},
+			Spec: v1beta1.ClusterSetSpec{
+				Selectors: []v1beta1.ClusterSelector{
+					{EKS: &v1beta1.EKSClusterSelector{Tags: map[string]string{"env": "prod"}, Region: "us-east-2"}},
+					{Karmada: &v1beta1.KarmadaClusterSelector{HubKubeconfigSecretRef: &v1beta1.SecretReference{Name: "hub"}}},
+				},
+				Exclude: &v1beta1.ClusterSelector{EKS: &v1beta1.EKSClusterSelector{Tags: map[string]string{"skip": "true"}}},
+				Template: v1beta1.ClusterSecretTemplate{
+					Metadata:     v1beta1.ClusterSecretTemplateMetadata{Labels: map[string]string{"env": "prod"}},
+					NameStrategy: "plain",
+				},
+			},
+		},
+	}
+
+	for name, src := range testcases {
+		t.Run(name, func(t *testing.T) {
+			var spoke ClusterSet
+
+			if err := spoke.ConvertFrom(src.DeepCopy()); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+
+			var got v1beta1.ClusterSet
+
+			if err := spoke.ConvertTo(&got); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+
+			if !equality.Semantic.DeepEqual(src, got) {
+				t.Errorf("unexpected round trip result:\n%s", diff.ObjectReflectDiff(src, got))
+			}
+		})
+	}
+}
+
+func TestConvertToWithoutSelectorMatchesAll(t *testing.T) {
+	src := ClusterSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "argocd"},
+	}
+
+	var dst v1beta1.ClusterSet
+
+	if err := src.ConvertTo(&dst); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+
+	if !dst.Spec.MatchAll {
+		t.Errorf("v1alpha1 ClusterSet without any selector must be converted with matchAll: true")
+	}
+
+	if len(dst.Spec.Selectors) != 0 {
+		t.Errorf("unexpected selectors: %v", dst.Spec.Selectors)
+	}
+}
+
+func TestConvertToSelector(t *testing.T) {
+	src := ClusterSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "argocd"},
+		Spec: ClusterSetSpec{
+			Selector: ClusterSelector{EKSTags: map[string]string{"env": "prod"}},
+		},
+	}
+
+	var dst v1beta1.ClusterSet
+
+	if err := src.ConvertTo(&dst); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+
+	want := []v1beta1.ClusterSelector{
+		{EKS: &v1beta1.EKSClusterSelector{Tags: map[string]string{"env": "prod"}}},
+	}
+
+	if !equality.Semantic.DeepEqual(want, dst.Spec.Selectors) {
+		t.Errorf("unexpected selectors:\n%s", diff.ObjectReflectDiff(want, dst.Spec.Selectors))
+	}
+
+	if dst.Spec.MatchAll {
+		t.Errorf("matchAll must not be set for a ClusterSet with a selector")
+	}
+}
@@ -18,20 +18,313 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // ClusterSetSpec defines the desired state of ClusterSet
 type ClusterSetSpec struct {
-	Selector ClusterSelector       `json:"selector,omitempty"`
+	// Selector selects the clusters to sync. Defaults to all the EKS clusters when neither Selector nor Selectors is set.
+	Selector ClusterSelector `json:"selector,omitempty"`
+
+	// MatchAll must be set to true to sync all the EKS clusters without any selector, so that an accidentally
+	// empty selector is rejected by the validating webhook instead of registering every cluster.
+	// +optional
+	MatchAll bool `json:"matchAll,omitempty"`
+
+	// Selectors selects clusters from multiple sources. The union of the clusters selected by Selector and Selectors
+	// are synced, de-duplicated by the API server URL.
+	// +optional
+	Selectors []ClusterSelector `json:"selectors,omitempty"`
+
+	// Exclude selects clusters that are never synced even when they are selected by Selector or Selectors.
+	// +optional
+	Exclude *ClusterSelector `json:"exclude,omitempty"`
+
 	Template ClusterSecretTemplate `json:"template"`
+
+	// RefreshInterval is the interval between syncs. Defaults to the `--sync-period` of the controller.
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+
+	// Suspend stops creating, updating and deleting cluster secrets, while still reporting drift in the status.
+	// Setting the `clusterset.mumo.co/paused: "true"` annotation has the same effect.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Prune configures how cluster secrets of clusters that are no longer selected are deleted.
+	// +optional
+	Prune *PruneSpec `json:"prune,omitempty"`
+
+	// Rollout limits how fast cluster secrets are created for newly selected clusters.
+	// +optional
+	Rollout *RolloutSpec `json:"rollout,omitempty"`
+
+	// Priority resolves conflicts with other ClusterSets in the namespace selecting the same clusters.
+	// The ClusterSet with the higher priority owns the cluster secret, and the current owner wins a tie.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// TargetNamespaces are the namespaces of the Argo CD instances the cluster secrets are written into.
+	// Defaults to the ClusterSet's namespace. Namespaces other than the ClusterSet's must be allowed by the
+	// `--allowed-target-namespaces` flag of the controller. Secrets referenced by the selectors are always read
+	// from the ClusterSet's namespace.
+	// +optional
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+
+	// Destinations are the Argo CD instances the cluster secrets are written into in addition to TargetNamespaces,
+	// including the ones on remote management clusters. Each destination is synced independently.
+	// +optional
+	Destinations []ClusterSetDestination `json:"destinations,omitempty"`
+
+	// ConnectivityCheck verifies that each selected cluster is reachable the way Argo CD connects to it,
+	// and reports the result in status.connectivity. Clusters aren't verified when omitted.
+	// +optional
+	ConnectivityCheck *ConnectivityCheckSpec `json:"connectivityCheck,omitempty"`
+}
+
+// ConnectivityCheckSpec verifies a cluster by a TLS handshake against the API server with the discovered CA,
+// followed by a `/version` call authenticated with the bearer token or the EKS token Argo CD would use.
+type ConnectivityCheckSpec struct {
+	// SkipUnreachable holds back the cluster secrets of unreachable clusters until they become reachable.
+	// Cluster secrets that already exist are kept either way.
+	// +optional
+	SkipUnreachable bool `json:"skipUnreachable,omitempty"`
+
+	// Timeout is the timeout of the check of each cluster. Defaults to 10s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ClusterSetDestination is an Argo CD instance the cluster secrets are written into
+type ClusterSetDestination struct {
+	// Namespace is the namespace of the Argo CD instance. Namespaces on the local cluster other than the ClusterSet's
+	// must be allowed by the `--allowed-target-namespaces` flag of the controller.
+	Namespace string `json:"namespace"`
+
+	// KubeconfigSecretRef references a secret in the ClusterSet's namespace whose `kubeconfig` key is used to
+	// connect to the remote management cluster the Argo CD instance runs on. Defaults to the local cluster.
+	// +optional
+	KubeconfigSecretRef *SecretReference `json:"kubeconfigSecretRef,omitempty"`
+}
+
+// RolloutSpec onboards newly selected clusters gradually, so that ApplicationSets don't deploy to all of them at once.
+// Clusters that already have cluster secrets are never held back.
+type RolloutSpec struct {
+	// MaxNewClusters is the maximum number of cluster secrets created per Interval. Unlimited when zero.
+	// +optional
+	MaxNewClusters int `json:"maxNewClusters,omitempty"`
+
+	// Interval is the minimum interval between waves of new clusters. Every sync is a wave when omitted.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// RequireApproval holds back new clusters until their cluster secret names are listed in the comma-separated
+	// `clusterset.mumo.co/approved-clusters` annotation of the ClusterSet, or the annotation is set to `*`.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
 }
 
+// PruneSpec guards cluster secrets against deletions caused by transient discovery failures,
+// like the AWS credentials briefly seeing no cluster due to a wrong region or an expired role.
+type PruneSpec struct {
+	// Disabled keeps cluster secrets of clusters that are no longer selected, instead of deleting them.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// GracePeriod is how long a cluster must be missing for before its cluster secret is deleted.
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+
+	// MaxDeletions is the maximum number, or the percentage of the cluster secrets managed by the ClusterSet like `10%`,
+	// of cluster secrets deleted in a sync. When exceeded, the controller deletes none and marks the ClusterSet Degraded.
+	// +optional
+	MaxDeletions *intstr.IntOrString `json:"maxDeletions,omitempty"`
+}
+
+const (
+	// AnnotationKeyPaused is the annotation that suspends the ClusterSet when set to "true"
+	AnnotationKeyPaused = "clusterset.mumo.co/paused"
+
+	// AnnotationKeyApprovedClusters is the annotation listing the comma-separated names of the cluster secrets approved
+	// to be created when spec.rollout.requireApproval is true. `*` approves all.
+	AnnotationKeyApprovedClusters = "clusterset.mumo.co/approved-clusters"
+
+	// ConditionTypeDegraded is true while the ClusterSet refuses to delete cluster secrets due to the prune policy
+	ConditionTypeDegraded = "Degraded"
+
+	// ConditionTypeConflict is true while other ClusterSets own some of the clusters selected by the ClusterSet
+	ConditionTypeConflict = "Conflict"
+)
+
+// IsPaused returns true when the ClusterSet is suspended either via spec.suspend or the paused annotation
+func (c *ClusterSet) IsPaused() bool {
+	return c.Spec.Suspend || c.Annotations[AnnotationKeyPaused] == "true"
+}
+
+// ClusterSelector selects clusters from exactly one source.
+// EKS is used unless either of HTTP, OCM or Karmada is set.
 type ClusterSelector struct {
 	EKSTags map[string]string `json:"eksTags,omitempty"`
+
+	// EKSRegion is the AWS region to discover EKS clusters in. Defaults to the region the controller is configured with.
+	// +optional
+	EKSRegion string `json:"eksRegion,omitempty"`
+
+	// EKSRoleARN is the ARN of the IAM role assumed to discover EKS clusters in another AWS account.
+	// Argo CD assumes the same role to authenticate against the discovered clusters.
+	// +optional
+	EKSRoleARN string `json:"eksRoleARN,omitempty"`
+
+	// HTTP discovers clusters from a JSON HTTP API like an in-house CMDB, instead of EKS.
+	// +optional
+	HTTP *HTTPClusterSelector `json:"http,omitempty"`
+
+	// OCM discovers clusters from Open Cluster Management ManagedClusters on the hub, instead of EKS.
+	// +optional
+	OCM *OCMClusterSelector `json:"ocm,omitempty"`
+
+	// Karmada discovers clusters from Karmada Clusters on the Karmada control plane, instead of EKS.
+	// +optional
+	Karmada *KarmadaClusterSelector `json:"karmada,omitempty"`
+}
+
+// HTTPClusterSelector discovers clusters by GETting a JSON document from the URL,
+// and mapping fields of each item in the document to cluster attributes with JSONPath expressions.
+type HTTPClusterSelector struct {
+	URL string `json:"url"`
+
+	// AuthSecretRef references a secret in the ClusterSet's namespace used to authenticate against the URL.
+	// The `token` key is sent as a bearer token, `tls.crt` and `tls.key` are used as the client certificate for mTLS,
+	// and `ca.crt` is used to verify the server certificate.
+	// +optional
+	AuthSecretRef *SecretReference `json:"authSecretRef,omitempty"`
+
+	// ItemsPath is the JSONPath expression to the list of clusters in the response. Defaults to `{.items[*]}`.
+	// +optional
+	ItemsPath string `json:"itemsPath,omitempty"`
+
+	// NextPath is the JSONPath expression to the URL of the next page in the response.
+	// Pagination stops when it resolves to nothing or an empty string.
+	// +optional
+	NextPath string `json:"nextPath,omitempty"`
+
+	Fields HTTPClusterFields `json:"fields"`
+
+	// MatchLabels selects clusters whose labels obtained via `fields.labels` contain all the key-value pairs.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+// HTTPClusterFields contains JSONPath expressions evaluated against each item to obtain cluster attributes
+type HTTPClusterFields struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+
+	// +optional
+	CAData string `json:"caData,omitempty"`
+
+	// AWSClusterName is the path to the EKS cluster name, used for the `awsAuthConfig` of the cluster secret.
+	// +optional
+	AWSClusterName string `json:"awsClusterName,omitempty"`
+
+	// BearerToken is the path to the token Argo CD uses to authenticate against the cluster.
+	// +optional
+	BearerToken string `json:"bearerToken,omitempty"`
+
+	// Labels is the path to a JSON object whose key-value pairs are used as cluster labels.
+	// +optional
+	Labels string `json:"labels,omitempty"`
+}
+
+// OCMClusterSelector selects available ManagedClusters (cluster.open-cluster-management.io/v1)
+type OCMClusterSelector struct {
+	// MatchLabels selects ManagedClusters whose labels contain all the key-value pairs.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+
+	// ManagedServiceAccount is the name of the ManagedServiceAccount whose token is used by Argo CD to
+	// authenticate against each cluster. The token is read from the secret of the same name in the namespace
+	// named after the ManagedCluster on the hub.
+	ManagedServiceAccount string `json:"managedServiceAccount"`
+
+	// HubKubeconfigSecretRef references a secret in the ClusterSet's namespace whose `kubeconfig` key is used to
+	// connect to the hub. Required, as the controller never reads the hub with its own identity.
+	// +optional
+	HubKubeconfigSecretRef *SecretReference `json:"hubKubeconfigSecretRef,omitempty"`
+}
+
+// KarmadaClusterSelector selects ready Clusters (cluster.karmada.io/v1alpha1)
+type KarmadaClusterSelector struct {
+	// MatchLabels selects Clusters whose labels contain all the key-value pairs.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+
+	// HubKubeconfigSecretRef references a secret in the ClusterSet's namespace whose `kubeconfig` key is used to
+	// connect to the Karmada control plane. Required, as the controller never reads it with its own identity.
+	// +optional
+	HubKubeconfigSecretRef *SecretReference `json:"hubKubeconfigSecretRef,omitempty"`
+}
+
+// SecretReference references a secret in the same namespace
+type SecretReference struct {
+	Name string `json:"name"`
+}
+
+// IsEmpty returns true when the selector has no source nor criteria configured
+func (s ClusterSelector) IsEmpty() bool {
+	return len(s.EKSTags) == 0 && s.EKSRegion == "" && s.EKSRoleARN == "" &&
+		s.HTTP == nil && s.OCM == nil && s.Karmada == nil
 }
 
 type ClusterSecretTemplate struct {
 	Metadata ClusterSecretTemplateMetadata `json:"metadata"`
+
+	// NameStrategy determines how cluster secrets are named.
+	// `plain` names the secret after the cluster, `prefixed` prepends `namePrefix` to the cluster name,
+	// `account-region-name` names it `<account>-<region>-<cluster>`, and `hashed` appends a hash of the cluster ARN or
+	// the server URL to the cluster name.
+	// Names are always made valid DNS-1123 subdomains, with a hash suffix added whenever the name had to be altered.
+	// Defaults to `plain`.
+	// +kubebuilder:validation:Enum=plain;prefixed;account-region-name;hashed
+	// +optional
+	NameStrategy string `json:"nameStrategy,omitempty"`
+
+	// NamePrefix is prepended to the cluster secret names when NameStrategy is `prefixed`.
+	// +optional
+	NamePrefix string `json:"namePrefix,omitempty"`
+
+	// EndpointAccess determines how EKS clusters whose API servers aren't reachable from Argo CD over the public
+	// endpoints are registered. They are registered as is when omitted.
+	// +optional
+	EndpointAccess *EndpointAccessSpec `json:"endpointAccess,omitempty"`
+}
+
+// EndpointAccessSpec is the policy for EKS clusters with private-only API server endpoints, so that Argo CD running in
+// a hub VPC can reach the spoke clusters via a proxy or PrivateLink.
+type EndpointAccessSpec struct {
+	// PrivateOnly is how private-only clusters are registered.
+	// `Register` registers them with their API server endpoints as is, `Skip` doesn't register them,
+	// and `Proxy` registers them with the server URLs rendered from ServerPattern.
+	// Defaults to `Register`.
+	// +kubebuilder:validation:Enum=Register;Skip;Proxy
+	// +optional
+	PrivateOnly string `json:"privateOnly,omitempty"`
+
+	// ServerPattern is the Go template of the server URLs of the clusters registered with the `Proxy` policy,
+	// like `https://{{ .Host }}.proxy.example.com`. `.Name`, `.Host`, `.Server`, `.AWSAccount` and `.AWSRegion`
+	// are available. The original hostname is set to `tlsClientConfig.serverName`, so that Argo CD verifies the
+	// API server certificate against it.
+	// +optional
+	ServerPattern string `json:"serverPattern,omitempty"`
+
+	// ServerName overrides `tlsClientConfig.serverName` of the clusters registered with the `Proxy` policy.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+
+	// PublicAccessCIDR is the CIDR Argo CD connects to the public endpoints from, like the one of the NAT gateway.
+	// Clusters whose public endpoints don't allow it in `publicAccessCidrs` are treated as private-only, too.
+	// +optional
+	PublicAccessCIDR string `json:"publicAccessCIDR,omitempty"`
 }
 
 type ClusterSecretTemplateMetadata struct {
@@ -45,6 +338,86 @@ type ClusterSetStatus struct {
 	Phase        string                   `json:"phase"`
 	Reason       string                   `json:"reason"`
 	Message      string                   `json:"message"`
+
+	// Conflicts lists clusters that two or more selectors disagreed on.
+	// +optional
+	Conflicts []ClusterSetConflict `json:"conflicts,omitempty"`
+
+	// Drift lists the changes to cluster secrets that are withheld while the ClusterSet is paused.
+	// +optional
+	Drift *ClusterSetDrift `json:"drift,omitempty"`
+
+	// PendingDeletions lists cluster secrets of clusters that are no longer selected, but kept by the prune policy.
+	// +optional
+	PendingDeletions []ClusterSetPendingDeletion `json:"pendingDeletions,omitempty"`
+
+	// PendingClusters lists cluster secret names of newly selected clusters held back by the rollout policy.
+	// +optional
+	PendingClusters []string `json:"pendingClusters,omitempty"`
+
+	// LastRolloutTime is when the last wave of new clusters was created.
+	// +optional
+	LastRolloutTime *metav1.Time `json:"lastRolloutTime,omitempty"`
+
+	// Destinations is the sync status of each destination.
+	// +optional
+	Destinations []ClusterSetDestinationStatus `json:"destinations,omitempty"`
+
+	// Connectivity is the result of the connectivity check of each selected cluster.
+	// +optional
+	Connectivity []ClusterConnectivityStatus `json:"connectivity,omitempty"`
+
+	// Conditions contains the Degraded condition, which is true while the prune policy refuses deletions,
+	// and the Conflict condition, which is true while other ClusterSets own some of the selected clusters.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClusterSetDestinationStatus is the sync status of a destination
+type ClusterSetDestinationStatus struct {
+	Namespace string `json:"namespace"`
+	// KubeconfigSecret is the name of the kubeconfig secret for the remote management cluster, if any.
+	// +optional
+	KubeconfigSecret string `json:"kubeconfigSecret,omitempty"`
+	// Phase is either of Synced, Degraded or Error
+	Phase   string `json:"phase"`
+	Message string `json:"message,omitempty"`
+}
+
+// ClusterConnectivityStatus is the result of the connectivity check of a cluster
+type ClusterConnectivityStatus struct {
+	// Name is the name of the cluster secret
+	Name      string `json:"name"`
+	Server    string `json:"server"`
+	Reachable bool   `json:"reachable"`
+	// Version is the Kubernetes version returned by the `/version` endpoint of the reachable cluster
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Message is why the cluster is unreachable
+	// +optional
+	Message       string      `json:"message,omitempty"`
+	LastCheckTime metav1.Time `json:"lastCheckTime"`
+}
+
+// ClusterSetPendingDeletion is a cluster secret whose cluster is no longer selected
+type ClusterSetPendingDeletion struct {
+	Name         string      `json:"name"`
+	MissingSince metav1.Time `json:"missingSince"`
+}
+
+// ClusterSetDrift contains the names of the cluster secrets that would be created, updated and deleted
+type ClusterSetDrift struct {
+	Create []string `json:"create,omitempty"`
+	Update []string `json:"update,omitempty"`
+	Delete []string `json:"delete,omitempty"`
+}
+
+// ClusterSetConflict describes clusters that two or more selectors disagreed on.
+// Only the cluster selected first is synced.
+type ClusterSetConflict struct {
+	Server   string   `json:"server"`
+	Clusters []string `json:"clusters"`
+	Message  string   `json:"message"`
 }
 
 // ClusterSetStatusClusters contains runner registration status
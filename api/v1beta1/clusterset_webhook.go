@@ -0,0 +1,304 @@
+/*
+Copyright 2020 The argocd-clusterset authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultPruneGracePeriod is how long a cluster must be missing for before its cluster secret is deleted,
+	// unless spec.prune.gracePeriod is set
+	DefaultPruneGracePeriod = 10 * time.Minute
+
+	// reservedLabelKey is set on every cluster secret, and can't be overridden by the template
+	reservedLabelKey = "argocd.argoproj.io/secret-type"
+)
+
+func (c *ClusterSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(c).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-clusterset-mumo-co-v1beta1-clusterset,mutating=true,failurePolicy=fail,sideEffects=None,groups=clusterset.mumo.co,resources=clustersets,verbs=create;update,versions=v1beta1,name=mclusterset.kb.io,admissionReviewVersions=v1beta1
+
+var _ webhook.Defaulter = &ClusterSet{}
+
+// Default implements webhook.Defaulter
+func (c *ClusterSet) Default() {
+	if c.Spec.Template.NameStrategy == "" {
+		c.Spec.Template.NameStrategy = "plain"
+	}
+
+	if c.Spec.Prune == nil {
+		c.Spec.Prune = &PruneSpec{}
+	}
+
+	if c.Spec.Prune.GracePeriod == nil {
+		c.Spec.Prune.GracePeriod = &metav1.Duration{Duration: DefaultPruneGracePeriod}
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-clusterset-mumo-co-v1beta1-clusterset,mutating=false,failurePolicy=fail,sideEffects=None,groups=clusterset.mumo.co,resources=clustersets,verbs=create;update,versions=v1beta1,name=vclusterset.kb.io,admissionReviewVersions=v1beta1
+
+var _ webhook.Validator = &ClusterSet{}
+
+// ValidateCreate implements webhook.Validator
+func (c *ClusterSet) ValidateCreate() error {
+	return c.invalid(c.validate())
+}
+
+// ValidateUpdate implements webhook.Validator.
+// Only the errors introduced by the update are rejected, so that ClusterSets created before a validation was added
+// can still be updated, including by the controller adding and removing its finalizer.
+func (c *ClusterSet) ValidateUpdate(old runtime.Object) error {
+	if c.DeletionTimestamp != nil {
+		return nil
+	}
+
+	oldClusterSet, ok := old.(*ClusterSet)
+	if !ok {
+		return c.ValidateCreate()
+	}
+
+	if equality.Semantic.DeepEqual(oldClusterSet.Spec, c.Spec) {
+		return nil
+	}
+
+	oldErrs := oldClusterSet.validate()
+
+	var errs field.ErrorList
+
+	for _, err := range c.validate() {
+		if !containsError(oldErrs, err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return c.invalid(errs)
+}
+
+// ValidateDelete implements webhook.Validator
+func (c *ClusterSet) ValidateDelete() error {
+	return nil
+}
+
+func (c *ClusterSet) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("ClusterSet").GroupKind(), c.Name, errs)
+}
+
+// containsError returns true when the same error is reported for the same field with the same value
+func containsError(errs field.ErrorList, err *field.Error) bool {
+	for _, e := range errs {
+		if e.Type == err.Type && e.Field == err.Field && equality.Semantic.DeepEqual(e.BadValue, err.BadValue) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *ClusterSet) validate() field.ErrorList {
+	var errs field.ErrorList
+
+	spec := field.NewPath("spec")
+
+	if !c.Spec.MatchAll && len(c.Spec.Selectors) == 0 {
+		errs = append(errs, field.Required(spec.Child("selectors"), "must select clusters, or set matchAll to true to sync all the EKS clusters"))
+	}
+
+	for i, sel := range c.Spec.Selectors {
+		path := spec.Child("selectors").Index(i)
+
+		errs = append(errs, sel.validate(path)...)
+
+		if !c.Spec.MatchAll && sel.matchesAll() {
+			errs = append(errs, field.Invalid(path, sel, "matches all the EKS clusters. Set matchAll to true if intended"))
+		}
+	}
+
+	if c.Spec.Exclude != nil {
+		errs = append(errs, c.Spec.Exclude.validate(spec.Child("exclude"))...)
+	}
+
+	if c.Spec.Exclude != nil && c.Spec.Exclude.matchesAll() {
+		errs = append(errs, field.Invalid(spec.Child("exclude"), c.Spec.Exclude, "excludes all the EKS clusters, which would delete every cluster secret"))
+	}
+
+	errs = append(errs, c.Spec.Template.validate(spec.Child("template"))...)
+
+	if i := c.Spec.RefreshInterval; i != nil && i.Duration <= 0 {
+		errs = append(errs, field.Invalid(spec.Child("refreshInterval"), i.Duration.String(), "must be positive"))
+	}
+
+	if p := c.Spec.Prune; p != nil {
+		errs = append(errs, p.validate(spec.Child("prune"))...)
+	}
+
+	if r := c.Spec.Rollout; r != nil {
+		if r.MaxNewClusters < 0 {
+			errs = append(errs, field.Invalid(spec.Child("rollout", "maxNewClusters"), r.MaxNewClusters, "must not be negative"))
+		}
+
+		if r.Interval != nil && r.Interval.Duration < 0 {
+			errs = append(errs, field.Invalid(spec.Child("rollout", "interval"), r.Interval.Duration.String(), "must not be negative"))
+		}
+	}
+
+	if cc := c.Spec.ConnectivityCheck; cc != nil && cc.Timeout != nil && cc.Timeout.Duration < 0 {
+		errs = append(errs, field.Invalid(spec.Child("connectivityCheck", "timeout"), cc.Timeout.Duration.String(), "must not be negative"))
+	}
+
+	for i, ns := range c.Spec.TargetNamespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(spec.Child("targetNamespaces").Index(i), ns, msg))
+		}
+	}
+
+	for i, d := range c.Spec.Destinations {
+		for _, msg := range validation.IsDNS1123Label(d.Namespace) {
+			errs = append(errs, field.Invalid(spec.Child("destinations").Index(i).Child("namespace"), d.Namespace, msg))
+		}
+	}
+
+	return errs
+}
+
+// matchesAll returns true when the selector selects all the EKS clusters in the region
+func (s ClusterSelector) matchesAll() bool {
+	return s.IsEmpty() || (s.EKS != nil && len(s.EKS.Tags) == 0 && s.HTTP == nil && s.OCM == nil && s.Karmada == nil)
+}
+
+func (s ClusterSelector) validate(path *field.Path) field.ErrorList {
+	var (
+		errs      field.ErrorList
+		providers []string
+	)
+
+	for name, set := range map[string]bool{
+		"eks":     s.EKS != nil,
+		"http":    s.HTTP != nil,
+		"ocm":     s.OCM != nil,
+		"karmada": s.Karmada != nil,
+	} {
+		if set {
+			providers = append(providers, name)
+		}
+	}
+
+	if len(providers) > 1 {
+		sort.Strings(providers)
+
+		errs = append(errs, field.Invalid(path, strings.Join(providers, ","), "must set exactly one of eks, http, ocm or karmada"))
+	}
+
+	// The controller never reads the hub with its own identity
+	if s.OCM != nil && s.OCM.HubKubeconfigSecretRef == nil {
+		errs = append(errs, field.Required(path.Child("ocm", "hubKubeconfigSecretRef"), "must reference the kubeconfig for the hub"))
+	}
+
+	if s.Karmada != nil && s.Karmada.HubKubeconfigSecretRef == nil {
+		errs = append(errs, field.Required(path.Child("karmada", "hubKubeconfigSecretRef"), "must reference the kubeconfig for the Karmada control plane"))
+	}
+
+	return errs
+}
+
+func (t ClusterSecretTemplate) validate(path *field.Path) field.ErrorList {
+	labelsPath := path.Child("metadata", "labels")
+
+	errs := metav1validation.ValidateLabels(t.Metadata.Labels, labelsPath)
+
+	if _, ok := t.Metadata.Labels[reservedLabelKey]; ok {
+		errs = append(errs, field.Forbidden(labelsPath.Key(reservedLabelKey), "is reserved for marking the secret as an Argo CD cluster secret"))
+	}
+
+	if t.NameStrategy == "prefixed" && t.NamePrefix == "" {
+		errs = append(errs, field.Required(path.Child("namePrefix"), "must be set when nameStrategy is prefixed"))
+	}
+
+	if e := t.EndpointAccess; e != nil {
+		errs = append(errs, e.validate(path.Child("endpointAccess"))...)
+	}
+
+	return errs
+}
+
+func (e EndpointAccessSpec) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if e.PrivateOnly == "Proxy" && e.ServerPattern == "" {
+		errs = append(errs, field.Required(path.Child("serverPattern"), "must be set when privateOnly is Proxy"))
+	}
+
+	if e.ServerPattern != "" {
+		if _, err := template.New("serverPattern").Option("missingkey=error").Parse(e.ServerPattern); err != nil {
+			errs = append(errs, field.Invalid(path.Child("serverPattern"), e.ServerPattern, err.Error()))
+		}
+	}
+
+	if e.PublicAccessCIDR != "" {
+		if _, _, err := net.ParseCIDR(e.PublicAccessCIDR); err != nil {
+			errs = append(errs, field.Invalid(path.Child("publicAccessCIDR"), e.PublicAccessCIDR, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func (p PruneSpec) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if p.GracePeriod != nil && p.GracePeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("gracePeriod"), p.GracePeriod.Duration.String(), "must not be negative"))
+	}
+
+	if m := p.MaxDeletions; m != nil {
+		switch {
+		case m.Type == intstr.Int && m.IntVal < 0:
+			errs = append(errs, field.Invalid(path.Child("maxDeletions"), m.String(), "must not be negative"))
+		case m.Type == intstr.String && !strings.HasSuffix(m.StrVal, "%"):
+			errs = append(errs, field.Invalid(path.Child("maxDeletions"), m.String(), "must be a number or a percentage like 10%"))
+		default:
+			if _, err := intstr.GetValueFromIntOrPercent(m, 100, false); err != nil {
+				errs = append(errs, field.Invalid(path.Child("maxDeletions"), m.String(), err.Error()))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The argocd-clusterset authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validClusterSet() *ClusterSet {
+	return &ClusterSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "argocd"},
+		Spec: ClusterSetSpec{
+			Selectors: []ClusterSelector{
+				{EKS: &EKSClusterSelector{Tags: map[string]string{"env": "prod"}}},
+			},
+		},
+	}
+}
+
+// legacyClusterSet returns a ClusterSet created before the validating webhook, which fails the validation for an empty selector
+func legacyClusterSet() *ClusterSet {
+	c := validClusterSet()
+	c.Spec.Selectors = nil
+
+	return c
+}
+
+func TestDefault(t *testing.T) {
+	c := validClusterSet()
+	c.Default()
+
+	if c.Spec.Template.NameStrategy != "plain" {
+		t.Errorf("unexpected nameStrategy: %q", c.Spec.Template.NameStrategy)
+	}
+
+	if c.Spec.Prune == nil || c.Spec.Prune.GracePeriod == nil || c.Spec.Prune.GracePeriod.Duration != DefaultPruneGracePeriod {
+		t.Errorf("unexpected prune: %+v", c.Spec.Prune)
+	}
+}
+
+func TestValidateCreate(t *testing.T) {
+	testcases := map[string]struct {
+		modify  func(c *ClusterSet)
+		invalid bool
+	}{
+		"valid": {
+			modify: func(c *ClusterSet) {},
+		},
+		"no selector": {
+			modify:  func(c *ClusterSet) { c.Spec.Selectors = nil },
+			invalid: true,
+		},
+		"no selector with matchAll": {
+			modify: func(c *ClusterSet) {
+				c.Spec.Selectors = nil
+				c.Spec.MatchAll = true
+			},
+		},
+		"selector matching all": {
+			modify: func(c *ClusterSet) {
+				c.Spec.Selectors = []ClusterSelector{{EKS: &EKSClusterSelector{Region: "us-east-2"}}}
+			},
+			invalid: true,
+		},
+		"exclude matching all": {
+			modify:  func(c *ClusterSet) { c.Spec.Exclude = &ClusterSelector{} },
+			invalid: true,
+		},
+		"reserved label": {
+			modify: func(c *ClusterSet) {
+				c.Spec.Template.Metadata.Labels = map[string]string{reservedLabelKey: "cluster"}
+			},
+			invalid: true,
+		},
+		"prefixed without prefix": {
+			modify:  func(c *ClusterSet) { c.Spec.Template.NameStrategy = "prefixed" },
+			invalid: true,
+		},
+		"negative refreshInterval": {
+			modify:  func(c *ClusterSet) { c.Spec.RefreshInterval = &metav1.Duration{Duration: -time.Minute} },
+			invalid: true,
+		},
+		"ocm without hub kubeconfig": {
+			modify: func(c *ClusterSet) {
+				c.Spec.Selectors = []ClusterSelector{{OCM: &OCMClusterSelector{ManagedServiceAccount: "argocd"}}}
+			},
+			invalid: true,
+		},
+		"karmada without hub kubeconfig": {
+			modify:  func(c *ClusterSet) { c.Spec.Selectors = []ClusterSelector{{Karmada: &KarmadaClusterSelector{}}} },
+			invalid: true,
+		},
+		"karmada with hub kubeconfig": {
+			modify: func(c *ClusterSet) {
+				c.Spec.Selectors = []ClusterSelector{{Karmada: &KarmadaClusterSelector{HubKubeconfigSecretRef: &SecretReference{Name: "karmada"}}}}
+			},
+		},
+		"invalid target namespace": {
+			modify:  func(c *ClusterSet) { c.Spec.TargetNamespaces = []string{"Argo_CD"} },
+			invalid: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			c := validClusterSet()
+			tc.modify(c)
+
+			err := c.ValidateCreate()
+
+			if tc.invalid && err == nil {
+				t.Errorf("expected error, got none")
+			} else if !tc.invalid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	testcases := map[string]struct {
+		old     *ClusterSet
+		modify  func(c *ClusterSet)
+		invalid bool
+	}{
+		"valid change": {
+			old:    validClusterSet(),
+			modify: func(c *ClusterSet) { c.Spec.Priority = 10 },
+		},
+		"invalid change": {
+			old:     validClusterSet(),
+			modify:  func(c *ClusterSet) { c.Spec.Template.NameStrategy = "prefixed" },
+			invalid: true,
+		},
+		"finalizer added to legacy": {
+			old:    legacyClusterSet(),
+			modify: func(c *ClusterSet) { c.Finalizers = []string{"runner.clusterset.mumo.co"} },
+		},
+		"deleting legacy": {
+			old: legacyClusterSet(),
+			modify: func(c *ClusterSet) {
+				now := metav1.Now()
+				c.DeletionTimestamp = &now
+				c.Finalizers = nil
+			},
+		},
+		"deleting with invalid change": {
+			old: validClusterSet(),
+			modify: func(c *ClusterSet) {
+				now := metav1.Now()
+				c.DeletionTimestamp = &now
+				c.Spec.Template.NameStrategy = "prefixed"
+			},
+		},
+		"unrelated change to legacy": {
+			old:    legacyClusterSet(),
+			modify: func(c *ClusterSet) { c.Spec.Priority = 10 },
+		},
+		"defaulted legacy": {
+			old:    legacyClusterSet(),
+			modify: func(c *ClusterSet) { c.Default() },
+		},
+		"invalid change to legacy": {
+			old:     legacyClusterSet(),
+			modify:  func(c *ClusterSet) { c.Spec.TargetNamespaces = []string{"Argo_CD"} },
+			invalid: true,
+		},
+		"changed invalid value": {
+			old: func() *ClusterSet {
+				c := validClusterSet()
+				c.Spec.RefreshInterval = &metav1.Duration{Duration: -time.Minute}
+				return c
+			}(),
+			modify:  func(c *ClusterSet) { c.Spec.RefreshInterval = &metav1.Duration{Duration: -time.Hour} },
+			invalid: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			c := tc.old.DeepCopy()
+			tc.modify(c)
+
+			err := c.ValidateUpdate(tc.old)
+
+			if tc.invalid && err == nil {
+				t.Errorf("expected error, got none")
+			} else if !tc.invalid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The argocd-clusterset authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// startWebhookEnv starts the API server with the admission webhooks in config/webhook served by a manager.
+// The test is skipped unless the envtest binaries are in KUBEBUILDER_ASSETS or /usr/local/kubebuilder/bin.
+func startWebhookEnv(t *testing.T) client.Client {
+	assets := os.Getenv("KUBEBUILDER_ASSETS")
+	if assets == "" {
+		assets = "/usr/local/kubebuilder/bin"
+	}
+
+	if _, err := os.Stat(filepath.Join(assets, "kube-apiserver")); err != nil {
+		t.Skipf("skipping the envtest webhook tests: %v", err)
+	}
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths: []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			DirectoryPaths: []string{filepath.Join("..", "..", "config", "webhook")},
+		},
+	}
+
+	cfg, err := testEnv.Start()
+	if err != nil {
+		t.Fatalf("starting envtest: %v", err)
+	}
+
+	stop := make(chan struct{})
+
+	t.Cleanup(func() {
+		close(stop)
+
+		if err := testEnv.Stop(); err != nil {
+			t.Errorf("stopping envtest: %v", err)
+		}
+	})
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = AddToScheme(scheme)
+
+	opts := testEnv.WebhookInstallOptions
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme,
+		Host:               opts.LocalServingHost,
+		Port:               opts.LocalServingPort,
+		CertDir:            opts.LocalServingCertDir,
+		MetricsBindAddress: "0",
+	})
+	if err != nil {
+		t.Fatalf("creating manager: %v", err)
+	}
+
+	if err := (&ClusterSet{}).SetupWebhookWithManager(mgr); err != nil {
+		t.Fatalf("setting up webhooks: %v", err)
+	}
+
+	go func() {
+		if err := mgr.Start(stop); err != nil {
+			t.Errorf("starting manager: %v", err)
+		}
+	}()
+
+	addr := net.JoinHostPort(opts.LocalServingHost, fmt.Sprint(opts.LocalServingPort))
+
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return false, nil
+		}
+
+		return true, conn.Close()
+	})
+	if err != nil {
+		t.Fatalf("waiting for the webhook server: %v", err)
+	}
+
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	return c
+}
+
+func TestWebhooks(t *testing.T) {
+	c := startWebhookEnv(t)
+	ctx := context.Background()
+
+	invalid := legacyClusterSet()
+	invalid.Namespace = "default"
+
+	if err := c.Create(ctx, invalid); !apierrors.IsInvalid(err) {
+		t.Fatalf("expected the ClusterSet without selectors to be rejected, got %v", err)
+	}
+
+	clusterSet := validClusterSet()
+	clusterSet.Namespace = "default"
+
+	if err := c.Create(ctx, clusterSet); err != nil {
+		t.Fatalf("creating ClusterSet: %v", err)
+	}
+
+	if clusterSet.Spec.Template.NameStrategy != "plain" || clusterSet.Spec.Prune == nil || clusterSet.Spec.Prune.GracePeriod == nil {
+		t.Errorf("ClusterSet isn't defaulted: %+v", clusterSet.Spec)
+	}
+
+	updated := clusterSet.DeepCopy()
+	updated.Spec.Template.NameStrategy = "prefixed"
+
+	if err := c.Update(ctx, updated); !apierrors.IsInvalid(err) {
+		t.Errorf("expected the update to an invalid spec to be rejected, got %v", err)
+	}
+
+	// The controller adds its finalizer on the first reconciliation, and removes it after deleting the cluster secrets
+	clusterSet.Finalizers = []string{"runner.clusterset.mumo.co"}
+
+	if err := c.Update(ctx, clusterSet); err != nil {
+		t.Fatalf("adding finalizer: %v", err)
+	}
+
+	if err := c.Delete(ctx, clusterSet); err != nil {
+		t.Fatalf("deleting ClusterSet: %v", err)
+	}
+
+	key := types.NamespacedName{Namespace: clusterSet.Namespace, Name: clusterSet.Name}
+
+	if err := c.Get(ctx, key, clusterSet); err != nil {
+		t.Fatalf("getting ClusterSet: %v", err)
+	}
+
+	clusterSet.Finalizers = nil
+
+	if err := c.Update(ctx, clusterSet); err != nil {
+		t.Fatalf("removing finalizer: %v", err)
+	}
+
+	if err := c.Get(ctx, key, clusterSet); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the ClusterSet to be deleted, got %v", err)
+	}
+}
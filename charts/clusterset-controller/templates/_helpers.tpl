@@ -84,3 +84,19 @@ Create the name of the service account to use
 {{- define "clusterset-controller.authProxyServiceName" -}}
 {{- include "clusterset-controller.fullname" . }}-controller-manager-metrics-service
 {{- end }}
+
+{{- define "clusterset-controller.webhookServiceName" -}}
+{{- include "clusterset-controller.fullname" . }}-webhook-service
+{{- end }}
+
+{{- define "clusterset-controller.servingCertName" -}}
+{{- include "clusterset-controller.fullname" . }}-serving-cert
+{{- end }}
+
+{{- define "clusterset-controller.selfSignedIssuerName" -}}
+{{- include "clusterset-controller.fullname" . }}-selfsigned-issuer
+{{- end }}
+
+{{- define "clusterset-controller.injectCAFrom" -}}
+{{ .Release.Namespace }}/{{ include "clusterset-controller.servingCertName" . }}
+{{- end }}
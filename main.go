@@ -3,13 +3,19 @@ package main
 import (
 	"fmt"
 	_ "github.com/aws/aws-sdk-go/service/eks"
+	"github.com/mumoshu/argocd-clusterset/pkg/clusterset"
 	"github.com/mumoshu/argocd-clusterset/pkg/manager"
 	"github.com/mumoshu/argocd-clusterset/pkg/run"
+	"io"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/exec"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
 const (
@@ -18,17 +24,46 @@ const (
 
 func main() {
 	var (
-		dryRun   bool
-		ns       string
-		name     string
-		endpoint string
-		caData   string
-		eksTags  []string
-		labelKVs []string
+		dryRun     bool
+		ns         string
+		name       string
+		endpoint   string
+		caData     string
+		eksTags    []string
+		eksRegion  string
+		eksRoleARN string
+		labelKVs   []string
+
+		nameStrategy string
+		namePrefix   string
+
+		pruneDisabled    bool
+		pruneGracePeriod time.Duration
+		maxDeletions     string
+
+		privateEndpointPolicy string
+		serverPattern         string
+		serverName            string
+		publicAccessCIDR      string
+
+		output           string
+		providerFixtures []string
+		fixture          []run.Cluster
 	)
 
 	cmd := &cobra.Command{
 		Use: ApplicationName,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(providerFixtures) == 0 {
+				return nil
+			}
+
+			var err error
+
+			fixture, err = run.LoadFixture(providerFixtures)
+
+			return err
+		},
 	}
 
 	flag := cmd.PersistentFlags()
@@ -39,7 +74,19 @@ func main() {
 	flag.StringVar(&endpoint, "endpoint", "", "")
 	flag.StringVar(&caData, "ca-data", "", "")
 	flag.StringSliceVar(&eksTags, "eks-tags", nil, "Comma-separated KEY=VALUE pairs of EKS control-plane tags")
+	flag.StringVar(&eksRegion, "eks-region", "", "AWS region to discover EKS clusters in")
+	flag.StringVar(&eksRoleARN, "eks-role-arn", "", "ARN of the IAM role assumed to discover EKS clusters in another AWS account")
 	flag.StringSliceVar(&labelKVs, "labels", nil, "Comma-separated KEY=VALUE pairs of cluster secret labels")
+	flag.StringVar(&nameStrategy, "name-strategy", run.NameStrategyPlain, "How cluster secrets are named. Either of plain, prefixed, account-region-name or hashed")
+	flag.StringVar(&namePrefix, "name-prefix", "", "Prefix of cluster secret names used when --name-strategy=prefixed")
+	flag.BoolVar(&pruneDisabled, "prune-disabled", false, "Keep cluster secrets of missing clusters instead of deleting them")
+	flag.DurationVar(&pruneGracePeriod, "prune-grace-period", 0, "How long a cluster must be missing for before its cluster secret is deleted")
+	flag.StringVar(&maxDeletions, "max-deletions", "", "Maximum number or percentage like 10% of cluster secrets deleted in a run. Nothing is deleted when exceeded")
+	flag.StringVar(&privateEndpointPolicy, "private-endpoint-policy", run.EndpointPolicyRegister, "How EKS clusters with private-only API server endpoints are registered. Either of Register, Skip or Proxy")
+	flag.StringVar(&serverPattern, "server-pattern", "", "Go template of the server URLs of the clusters registered with --private-endpoint-policy=Proxy, like https://{{ .Host }}.proxy.example.com")
+	flag.StringVar(&serverName, "server-name", "", "TLS server name of the clusters registered with --private-endpoint-policy=Proxy. Defaults to the original hostname")
+	flag.StringVar(&publicAccessCIDR, "public-access-cidr", "", "CIDR Argo CD connects to public EKS endpoints from. Clusters whose public endpoints don't allow it are treated as private-only")
+	flag.StringVarP(&output, "output", "o", run.OutputFormatTable, "Output format of plan, list and get. Either of table, wide, json or yaml. get prints yaml unless specified")
 
 	newLabels := func() map[string]string {
 		labels := map[string]string{}
@@ -47,8 +94,13 @@ func main() {
 		return labels
 	}
 
+	log := zap.New(func(o *zap.Options) {
+		o.Development = true
+	})
+
 	newConfig := func() run.Config {
 		return run.Config{
+			Log:      log,
 			DryRun:   dryRun,
 			NS:       ns,
 			Name:     name,
@@ -66,10 +118,35 @@ func main() {
 		}
 
 		setConfig := run.ClusterSetConfig{
+			Log:     log,
+			Fixture: fixture,
 			DryRun:  dryRun,
 			NS:      ns,
-			EKSTags: tags,
-			Labels:  newLabels(),
+			Selectors: []run.SelectorConfig{
+				{
+					EKSTags:    tags,
+					EKSRegion:  eksRegion,
+					EKSRoleARN: eksRoleARN,
+				},
+			},
+			Labels:       newLabels(),
+			NameStrategy: nameStrategy,
+			NamePrefix:   namePrefix,
+			Prune: run.PruneConfig{
+				Disabled:    pruneDisabled,
+				GracePeriod: pruneGracePeriod,
+			},
+			EndpointAccess: run.EndpointAccessConfig{
+				PrivateOnly:      privateEndpointPolicy,
+				ServerPattern:    serverPattern,
+				ServerName:       serverName,
+				PublicAccessCIDR: publicAccessCIDR,
+			},
+		}
+
+		if maxDeletions != "" {
+			v := intstr.Parse(maxDeletions)
+			setConfig.Prune.MaxDeletions = &v
 		}
 
 		return setConfig
@@ -107,14 +184,190 @@ func main() {
 	}
 	cmd.AddCommand(deleteMissing)
 
+	var filenames []string
+
+	newManifestOptions := func() clusterset.Options {
+		return clusterset.Options{
+			Log:     log,
+			NS:      ns,
+			DryRun:  dryRun,
+			Fixture: fixture,
+		}
+	}
+
+	// newSetConfigs returns the configs of the ClusterSets in the manifests given via -f, or the one given via flags
+	newSetConfigs := func() ([]run.ClusterSetConfig, error) {
+		if len(filenames) == 0 {
+			return []run.ClusterSetConfig{newSetConfig()}, nil
+		}
+
+		clusterSets, err := clusterset.LoadFiles(filenames, os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+
+		return clusterset.Configs(clusterSets, newManifestOptions())
+	}
+
 	sync := &cobra.Command{
 		Use: "sync",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return run.Sync(newSetConfig())
+			if len(filenames) > 0 {
+				clusterSets, err := clusterset.LoadFiles(filenames, os.Stdin)
+				if err != nil {
+					return err
+				}
+
+				return clusterset.Sync(clusterSets, newManifestOptions())
+			}
+
+			_, err := run.Sync(newSetConfig())
+
+			return err
 		},
 	}
+	sync.Flags().StringSliceVarP(&filenames, "filename", "f", nil, "ClusterSet manifests to sync, in place of the selector and the template given via flags. - reads from stdin")
 	cmd.AddCommand(sync)
 
+	plan := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes sync would make to the cluster secrets. Exits with 2 when there are changes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := run.NewPlan(newSetConfig())
+			if p == nil {
+				return err
+			}
+
+			if writeErr := run.WriteOutput(os.Stdout, output, p, p.WriteText); writeErr != nil {
+				return writeErr
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if p.HasChanges() {
+				os.Exit(2)
+			}
+
+			return nil
+		},
+	}
+	cmd.AddCommand(plan)
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the discovered clusters along with the states of their cluster secrets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			clusters, err := run.ListClusters(newSetConfig())
+			if err != nil {
+				return err
+			}
+
+			return run.WriteOutput(os.Stdout, output, clusters, func(w io.Writer, wide bool) error {
+				return run.WriteClusterTable(w, clusters, wide)
+			})
+		},
+	}
+	cmd.AddCommand(list)
+
+	get := &cobra.Command{
+		Use:   "get CLUSTER",
+		Short: "Print the cluster secret rendered for the cluster, which is looked up by the cluster name or the cluster secret name",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := output
+
+			// The rendered secret is what users are after, unlike the other commands that default to tables
+			if !cmd.Flags().Changed("output") {
+				format = run.OutputFormatYAML
+			}
+
+			clusters, err := run.ListClusters(newSetConfig())
+			if err != nil {
+				return err
+			}
+
+			for _, c := range clusters {
+				if c.Name != args[0] && c.SecretName != args[0] {
+					continue
+				}
+
+				return run.WriteOutput(os.Stdout, format, c.Rendered, func(w io.Writer, wide bool) error {
+					return run.WriteClusterTable(w, []run.ClusterInfo{c}, wide)
+				})
+			}
+
+			return fmt.Errorf("cluster %q not found", args[0])
+		},
+	}
+	cmd.AddCommand(get)
+
+	render := &cobra.Command{
+		Use:   "render",
+		Short: "Print the cluster secrets rendered for the selected clusters without reading or writing any cluster secret. Prints yaml unless -o is specified",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := output
+			if !cmd.Flags().Changed("output") {
+				format = run.OutputFormatYAML
+			}
+
+			configs, err := newSetConfigs()
+			if err != nil {
+				return err
+			}
+
+			var secrets []*corev1.Secret
+
+			for _, c := range configs {
+				rendered, err := run.Render(c)
+				if err != nil {
+					return err
+				}
+
+				secrets = append(secrets, rendered...)
+			}
+
+			return run.WriteSecrets(os.Stdout, format, secrets)
+		},
+	}
+	render.Flags().StringSliceVarP(&filenames, "filename", "f", nil, "ClusterSet manifests to render, in place of the selector and the template given via flags. - reads from stdin")
+	cmd.AddCommand(render)
+
+	// Only the commands that never write cluster secrets accept provider fixtures, whose bearer tokens are redacted
+	for _, c := range []*cobra.Command{plan, list, get, render} {
+		c.Flags().StringSliceVar(&providerFixtures, "provider-fixture", nil, "Files of recorded clusters to select from in place of EKS and the other providers, like the ones record writes")
+	}
+
+	record := &cobra.Command{
+		Use:   "record",
+		Short: "Print the clusters discovered from the providers as a provider fixture for --provider-fixture. Bearer tokens are redacted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := output
+			if !cmd.Flags().Changed("output") {
+				format = run.OutputFormatYAML
+			}
+
+			if format != run.OutputFormatJSON && format != run.OutputFormatYAML {
+				return fmt.Errorf("record supports only %s and %s outputs", run.OutputFormatJSON, run.OutputFormatYAML)
+			}
+
+			configs, err := newSetConfigs()
+			if err != nil {
+				return err
+			}
+
+			clusters, err := run.Record(configs)
+			if err != nil {
+				return err
+			}
+
+			return run.WriteOutput(os.Stdout, format, clusters, nil)
+		},
+	}
+	record.Flags().StringSliceVarP(&filenames, "filename", "f", nil, "ClusterSet manifests whose selectors are recorded, in place of the selector given via flags. - reads from stdin")
+	cmd.AddCommand(record)
+
 	m := &manager.Manager{}
 
 	controllerManager := &cobra.Command{
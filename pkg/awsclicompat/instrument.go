@@ -0,0 +1,33 @@
+package awsclicompat
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/mumoshu/argocd-clusterset/pkg/metrics"
+)
+
+// Instrument counts the API calls made by the client and the ones failed after all the retries.
+// The account can be empty when unknown.
+func Instrument(c *client.Client, account string) {
+	service := c.ClientInfo.ServiceName
+	region := aws.StringValue(c.Config.Region)
+
+	c.Handlers.Complete.PushBack(func(r *request.Request) {
+		op := r.Operation.Name
+
+		metrics.AWSAPICalls.WithLabelValues(service, op, account, region).Inc()
+
+		if r.Error == nil {
+			return
+		}
+
+		code := "Unknown"
+		if aerr, ok := r.Error.(awserr.Error); ok {
+			code = aerr.Code()
+		}
+
+		metrics.AWSAPIErrors.WithLabelValues(service, op, account, region, code).Inc()
+	})
+}
@@ -0,0 +1,60 @@
+package awsclicompat
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/mumoshu/argocd-clusterset/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/xerrors"
+)
+
+func TestInstrument(t *testing.T) {
+	testcases := map[string]struct {
+		account string
+		err     error
+		code    string
+	}{
+		"succeeded":     {account: "111111111111"},
+		"aws error":     {account: "222222222222", err: awserr.New("ThrottlingException", "Rate exceeded", nil), code: "ThrottlingException"},
+		"non-aws error": {account: "333333333333", err: xerrors.New("connection reset"), code: "Unknown"},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			c := client.New(aws.Config{Region: aws.String("us-east-2")}, metadata.ClientInfo{ServiceName: "eks"}, request.Handlers{})
+
+			// The stubbed handler stands in for the HTTP round trip
+			c.Handlers.Send.PushBack(func(r *request.Request) {
+				r.Error = tc.err
+			})
+
+			Instrument(c, tc.account)
+
+			r := c.NewRequest(&request.Operation{Name: "ListClusters"}, nil, nil)
+
+			if err := r.Send(); err != tc.err {
+				t.Fatalf("unexpected error: want %v, got %v", tc.err, err)
+			}
+
+			if got := testutil.ToFloat64(metrics.AWSAPICalls.WithLabelValues("eks", "ListClusters", tc.account, "us-east-2")); got != 1 {
+				t.Errorf("expected the call to be counted once, got %v", got)
+			}
+
+			for _, code := range []string{"ThrottlingException", "Unknown"} {
+				want := 0.0
+				if code == tc.code {
+					want = 1
+				}
+
+				if got := testutil.ToFloat64(metrics.AWSAPIErrors.WithLabelValues("eks", "ListClusters", tc.account, "us-east-2", code)); got != want {
+					t.Errorf("expected %v errors with code %s, got %v", want, code, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package awsclicompat
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+// Throttle retries AWS API calls failed due to throttling with exponential backoff and jitter,
+// and rate-limits AWS API calls per account and region on the client side.
+//
+// A Throttle must be shared across all the AWS clients so that the rate limits are enforced process-wide.
+type Throttle struct {
+	// MaxRetries is the maximum number of retries for each API call
+	MaxRetries int
+	// MinThrottleDelay and MaxThrottleDelay bound the exponential backoff of the retries on throttling errors
+	// like ThrottlingException and TooManyRequestsException
+	MinThrottleDelay time.Duration
+	MaxThrottleDelay time.Duration
+
+	// QPS is the number of API calls allowed per second per account and region. Unlimited when zero.
+	QPS   float64
+	Burst int
+	// QPSOverrides overrides QPS per `ACCOUNT/REGION`, `/REGION` or `REGION`.
+	// The account is known only for clients that assume a role, so `/REGION` is the key for the controller's own account.
+	QPSOverrides map[string]float64
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// ParseQPSOverrides parses comma-separated `ACCOUNT/REGION=QPS`, `/REGION=QPS` or `REGION=QPS` pairs
+func ParseQPSOverrides(s string) (map[string]float64, error) {
+	overrides := map[string]float64{}
+
+	for _, kv := range strings.Split(s, ",") {
+		if kv == "" {
+			continue
+		}
+
+		split := strings.SplitN(kv, "=", 2)
+		if len(split) != 2 {
+			return nil, xerrors.Errorf("invalid QPS override %q: must be in the form of ACCOUNT/REGION=QPS, /REGION=QPS or REGION=QPS", kv)
+		}
+
+		qps, err := strconv.ParseFloat(split[1], 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid QPS in %q: %w", kv, err)
+		}
+
+		overrides[split[0]] = qps
+	}
+
+	return overrides, nil
+}
+
+// Config returns the configuration to retry throttled API calls
+func (t *Throttle) Config() *aws.Config {
+	return request.WithRetryer(aws.NewConfig(), client.DefaultRetryer{
+		NumMaxRetries:    t.MaxRetries,
+		MinThrottleDelay: t.MinThrottleDelay,
+		MaxThrottleDelay: t.MaxThrottleDelay,
+	})
+}
+
+// Limit makes every API call made by the client, including retries, wait for the rate limiter of the account and region.
+// The account is empty for clients using the controller's own credentials, whose overrides are keyed by `/REGION`.
+func (t *Throttle) Limit(c *client.Client, account string) {
+	limiter := t.limiter(account, aws.StringValue(c.Config.Region))
+	if limiter == nil {
+		return
+	}
+
+	c.Handlers.Send.PushFront(func(r *request.Request) {
+		if err := limiter.Wait(r.Context()); err != nil {
+			r.Error = err
+		}
+	})
+}
+
+func (t *Throttle) limiter(account, region string) *rate.Limiter {
+	qps := t.QPS
+
+	// The key is `/REGION` when the account is unknown, which is the case for the controller's own account
+	key := account + "/" + region
+
+	if v, ok := t.QPSOverrides[key]; ok {
+		qps = v
+	} else if v, ok := t.QPSOverrides[region]; ok {
+		qps = v
+	}
+
+	if qps <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limiters == nil {
+		t.limiters = map[string]*rate.Limiter{}
+	}
+
+	l, ok := t.limiters[key]
+	if !ok {
+		burst := t.Burst
+		if burst < 1 {
+			burst = 1
+		}
+
+		l = rate.NewLimiter(rate.Limit(qps), burst)
+		t.limiters[key] = l
+	}
+
+	return l
+}
@@ -0,0 +1,65 @@
+package awsclicompat
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"golang.org/x/time/rate"
+)
+
+func TestThrottleLimit(t *testing.T) {
+	overrides, err := ParseQPSOverrides("111111111111/us-east-1=2,/us-east-1=4,eu-west-1=5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testcases := map[string]struct {
+		account string
+		region  string
+		want    rate.Limit
+	}{
+		"account and region": {account: "111111111111", region: "us-east-1", want: 2},
+		"own account":        {region: "us-east-1", want: 4},
+		"region":             {account: "222222222222", region: "eu-west-1", want: 5},
+		"own account region": {region: "eu-west-1", want: 5},
+		"default":            {account: "222222222222", region: "us-east-1", want: 10},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			throttle := &Throttle{QPS: 10, Burst: 1, QPSOverrides: overrides}
+
+			c := client.New(aws.Config{Region: aws.String(tc.region)}, metadata.ClientInfo{}, request.Handlers{})
+
+			throttle.Limit(c, tc.account)
+
+			if c.Handlers.Send.Len() != 1 {
+				t.Fatalf("expected the rate limiter to be installed, got %d send handlers", c.Handlers.Send.Len())
+			}
+
+			l := throttle.limiters[tc.account+"/"+tc.region]
+			if l == nil {
+				t.Fatalf("expected a rate limiter for %s/%s, got %v", tc.account, tc.region, throttle.limiters)
+			}
+
+			if l.Limit() != tc.want {
+				t.Errorf("expected %v QPS, got %v", tc.want, l.Limit())
+			}
+		})
+	}
+}
+
+func TestThrottleUnlimited(t *testing.T) {
+	throttle := &Throttle{QPSOverrides: map[string]float64{"/us-east-1": 4}}
+
+	c := client.New(aws.Config{Region: aws.String("eu-west-1")}, metadata.ClientInfo{}, request.Handlers{})
+
+	throttle.Limit(c, "")
+
+	if c.Handlers.Send.Len() != 0 {
+		t.Errorf("expected no rate limiter without QPS, got %d send handlers", c.Handlers.Send.Len())
+	}
+}
@@ -0,0 +1,165 @@
+package clusterset
+
+import (
+	"strings"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+	"github.com/mumoshu/argocd-clusterset/pkg/run"
+	"golang.org/x/xerrors"
+)
+
+// NewConfig returns the configuration run.Sync takes to sync the ClusterSet, which is shared by the controller and the command-line tool.
+// Runtime dependencies like the logger, the discovery cache and the priorities of the other ClusterSets are left to the caller.
+// The ClusterSet is defaulted the same as the defaulting webhook does, so that the ones created without the webhook sync the same.
+// It isn't validated here, so that ClusterSets admitted before a validation was added keep syncing. The only exception is
+// selecting no cluster without matchAll, so that a ClusterSet that lost its selectors, like a v1alpha1 one read without
+// the conversion webhook, never registers all the EKS clusters.
+func NewConfig(clusterSet *v1beta1.ClusterSet) (run.ClusterSetConfig, error) {
+	clusterSet = clusterSet.DeepCopy()
+	clusterSet.Default()
+
+	if !clusterSet.Spec.MatchAll && len(clusterSet.Spec.Selectors) == 0 {
+		return run.ClusterSetConfig{}, xerrors.New("spec.selectors is empty: set matchAll to true to sync all the EKS clusters")
+	}
+
+	config := run.ClusterSetConfig{
+		DryRun:   false,
+		NS:       clusterSet.Namespace,
+		Name:     clusterSet.Name,
+		Priority: clusterSet.Spec.Priority,
+		Labels:   clusterSet.Spec.Template.Metadata.Labels,
+
+		TargetNamespaces: clusterSet.Spec.TargetNamespaces,
+		NameStrategy:     clusterSet.Spec.Template.NameStrategy,
+		NamePrefix:       clusterSet.Spec.Template.NamePrefix,
+	}
+
+	for _, d := range clusterSet.Spec.Destinations {
+		dest := run.DestinationConfig{
+			Namespace: d.Namespace,
+		}
+
+		if d.KubeconfigSecretRef != nil {
+			dest.KubeconfigSecretName = d.KubeconfigSecretRef.Name
+		}
+
+		config.Destinations = append(config.Destinations, dest)
+	}
+
+	if r := clusterSet.Spec.Rollout; r != nil {
+		config.Rollout = run.RolloutConfig{
+			MaxNewClusters:  r.MaxNewClusters,
+			RequireApproval: r.RequireApproval,
+		}
+
+		if r.Interval != nil {
+			config.Rollout.Interval = r.Interval.Duration
+		}
+
+		if t := clusterSet.Status.LastRolloutTime; t != nil {
+			config.Rollout.LastWave = t.Time
+		}
+
+		if approved := clusterSet.Annotations[v1beta1.AnnotationKeyApprovedClusters]; approved != "" {
+			for _, name := range strings.Split(approved, ",") {
+				config.Rollout.Approved = append(config.Rollout.Approved, strings.TrimSpace(name))
+			}
+		}
+	}
+
+	if e := clusterSet.Spec.Template.EndpointAccess; e != nil {
+		config.EndpointAccess = run.EndpointAccessConfig{
+			PrivateOnly:      e.PrivateOnly,
+			ServerPattern:    e.ServerPattern,
+			ServerName:       e.ServerName,
+			PublicAccessCIDR: e.PublicAccessCIDR,
+		}
+	}
+
+	if c := clusterSet.Spec.ConnectivityCheck; c != nil {
+		config.Connectivity = run.ConnectivityConfig{
+			Enabled:         true,
+			SkipUnreachable: c.SkipUnreachable,
+		}
+
+		if c.Timeout != nil {
+			config.Connectivity.Timeout = c.Timeout.Duration
+		}
+	}
+
+	if p := clusterSet.Spec.Prune; p != nil {
+		config.Prune = run.PruneConfig{
+			Disabled:     p.Disabled,
+			MaxDeletions: p.MaxDeletions,
+		}
+
+		if p.GracePeriod != nil {
+			config.Prune.GracePeriod = p.GracePeriod.Duration
+		}
+	}
+
+	for _, sel := range clusterSet.Spec.Selectors {
+		config.Selectors = append(config.Selectors, newSelectorConfig(sel))
+	}
+
+	if clusterSet.Spec.Exclude != nil {
+		exclude := newSelectorConfig(*clusterSet.Spec.Exclude)
+		config.Exclude = &exclude
+	}
+
+	return config, nil
+}
+
+func newSelectorConfig(sel v1beta1.ClusterSelector) run.SelectorConfig {
+	var config run.SelectorConfig
+
+	if e := sel.EKS; e != nil {
+		config.EKSTags = e.Tags
+		config.EKSRegion = e.Region
+		config.EKSRoleARN = e.RoleARN
+	}
+
+	if h := sel.HTTP; h != nil {
+		config.HTTP = &run.HTTPConfig{
+			URL:       h.URL,
+			ItemsPath: h.ItemsPath,
+			NextPath:  h.NextPath,
+			Fields: run.HTTPFields{
+				Name:           h.Fields.Name,
+				Server:         h.Fields.Server,
+				CAData:         h.Fields.CAData,
+				AWSClusterName: h.Fields.AWSClusterName,
+				BearerToken:    h.Fields.BearerToken,
+				Labels:         h.Fields.Labels,
+			},
+			MatchLabels: h.MatchLabels,
+		}
+
+		if h.AuthSecretRef != nil {
+			config.HTTP.AuthSecretName = h.AuthSecretRef.Name
+		}
+	}
+
+	if o := sel.OCM; o != nil {
+		config.OCM = &run.OCMConfig{
+			MatchLabels:           o.MatchLabels,
+			ManagedServiceAccount: o.ManagedServiceAccount,
+		}
+
+		if o.HubKubeconfigSecretRef != nil {
+			config.OCM.HubKubeconfigSecretName = o.HubKubeconfigSecretRef.Name
+		}
+	}
+
+	if k := sel.Karmada; k != nil {
+		config.Karmada = &run.KarmadaConfig{
+			MatchLabels: k.MatchLabels,
+		}
+
+		if k.HubKubeconfigSecretRef != nil {
+			config.Karmada.HubKubeconfigSecretName = k.HubKubeconfigSecretRef.Name
+		}
+	}
+
+	return config
+}
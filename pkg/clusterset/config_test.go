@@ -0,0 +1,132 @@
+package clusterset
+
+import (
+	"strings"
+	"testing"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+)
+
+const (
+	validManifest = `
+apiVersion: clusterset.mumo.co/v1beta1
+kind: ClusterSet
+metadata:
+  name: prod
+spec:
+  selectors:
+  - eks:
+      tags:
+        env: prod
+`
+
+	// The v1alpha1 ClusterSet without a selector is converted with matchAll
+	legacyManifest = `
+apiVersion: clusterset.mumo.co/v1alpha1
+kind: ClusterSet
+metadata:
+  name: all
+`
+
+	invalidManifest = `
+apiVersion: clusterset.mumo.co/v1beta1
+kind: ClusterSet
+metadata:
+  name: prefixed
+spec:
+  selectors:
+  - eks:
+      tags:
+        env: prod
+  template:
+    nameStrategy: prefixed
+`
+)
+
+func TestLoadAndConfigs(t *testing.T) {
+	testcases := map[string]struct {
+		manifest string
+		invalid  bool
+	}{
+		"valid":   {manifest: validManifest},
+		"legacy":  {manifest: legacyManifest},
+		"invalid": {manifest: invalidManifest, invalid: true},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			clusterSets, err := Load(strings.NewReader(tc.manifest))
+
+			if tc.invalid {
+				if err == nil || !strings.Contains(err.Error(), "validating ClusterSet") {
+					t.Errorf("expected validation error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			configs, err := Configs(clusterSets, Options{Log: logrtesting.NullLogger{}, NS: "argocd"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(configs) != 1 || configs[0].NameStrategy != "plain" {
+				t.Errorf("expected the ClusterSet to be defaulted, got %+v", configs)
+			}
+		})
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	clusterSet := func(modify func(spec *v1beta1.ClusterSetSpec)) *v1beta1.ClusterSet {
+		c := &v1beta1.ClusterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "prod"},
+			Spec: v1beta1.ClusterSetSpec{
+				Selectors: []v1beta1.ClusterSelector{{EKS: &v1beta1.EKSClusterSelector{Tags: map[string]string{"env": "prod"}}}},
+			},
+		}
+
+		modify(&c.Spec)
+
+		return c
+	}
+
+	testcases := map[string]struct {
+		clusterSet *v1beta1.ClusterSet
+		invalid    bool
+	}{
+		// Admitted before the validation for namePrefix was added
+		"grandfathered": {
+			clusterSet: clusterSet(func(spec *v1beta1.ClusterSetSpec) { spec.Template.NameStrategy = "prefixed" }),
+		},
+		"no selector": {
+			clusterSet: clusterSet(func(spec *v1beta1.ClusterSetSpec) { spec.Selectors = nil }),
+			invalid:    true,
+		},
+		"match all": {
+			clusterSet: clusterSet(func(spec *v1beta1.ClusterSetSpec) {
+				spec.Selectors = nil
+				spec.MatchAll = true
+			}),
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConfig(tc.clusterSet)
+
+			if tc.invalid && err == nil {
+				t.Errorf("expected error, got none")
+			} else if !tc.invalid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
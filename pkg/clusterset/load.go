@@ -0,0 +1,105 @@
+package clusterset
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1alpha1"
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+var (
+	scheme = runtime.NewScheme()
+	codecs = serializer.NewCodecFactory(scheme)
+)
+
+func init() {
+	_ = v1alpha1.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+}
+
+// LoadFiles loads ClusterSets from the manifest files. `-` reads from stdin.
+func LoadFiles(paths []string, stdin io.Reader) ([]v1beta1.ClusterSet, error) {
+	var clusterSets []v1beta1.ClusterSet
+
+	for _, path := range paths {
+		loaded, err := loadFile(path, stdin)
+		if err != nil {
+			return nil, xerrors.Errorf("loading %s: %w", path, err)
+		}
+
+		clusterSets = append(clusterSets, loaded...)
+	}
+
+	return clusterSets, nil
+}
+
+func loadFile(path string, stdin io.Reader) ([]v1beta1.ClusterSet, error) {
+	if path == "-" {
+		return Load(stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Load decodes the ClusterSets in the multi-document YAML or JSON stream.
+// v1alpha1 ClusterSets are converted to v1beta1, and all of them are defaulted and validated the same as the admission webhooks do,
+// so that they behave the same as the ones applied to the cluster.
+func Load(r io.Reader) ([]v1beta1.ClusterSet, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+
+	var clusterSets []v1beta1.ClusterSet
+
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, xerrors.Errorf("reading document %d: %w", i, err)
+		}
+
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, _, err := codecs.UniversalDeserializer().Decode(doc, nil, nil)
+		if err != nil {
+			return nil, xerrors.Errorf("decoding document %d: %w", i, err)
+		}
+
+		var clusterSet v1beta1.ClusterSet
+
+		switch o := obj.(type) {
+		case *v1beta1.ClusterSet:
+			clusterSet = *o
+		case *v1alpha1.ClusterSet:
+			if err := o.ConvertTo(&clusterSet); err != nil {
+				return nil, xerrors.Errorf("converting ClusterSet %q to v1beta1: %w", o.Name, err)
+			}
+		default:
+			return nil, xerrors.Errorf("document %d is %T, but only ClusterSets are supported", i, obj)
+		}
+
+		clusterSet.Default()
+
+		if err := clusterSet.ValidateCreate(); err != nil {
+			return nil, xerrors.Errorf("validating ClusterSet %q: %w", clusterSet.Name, err)
+		}
+
+		clusterSets = append(clusterSets, clusterSet)
+	}
+
+	return clusterSets, nil
+}
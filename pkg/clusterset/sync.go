@@ -0,0 +1,98 @@
+package clusterset
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+	"github.com/mumoshu/argocd-clusterset/pkg/run"
+	"golang.org/x/xerrors"
+)
+
+// Options configures how ClusterSets loaded from manifests are run from the command-line
+type Options struct {
+	Log logr.Logger
+	// NS is the namespace of the ClusterSets without namespaces
+	NS string
+	// DryRun syncs all the ClusterSets without making any change. Paused ClusterSets are always synced with DryRun.
+	DryRun bool
+	// Fixture is the recorded clusters selected from in place of the providers, when not nil
+	Fixture []run.Cluster
+}
+
+// Configs returns the configs to sync the ClusterSets with, the same as the controller does.
+// Conflicts are resolved among the given ClusterSets, as the ones in the cluster can't be listed without the CRD.
+func Configs(clusterSets []v1beta1.ClusterSet, opts Options) ([]run.ClusterSetConfig, error) {
+	for i := range clusterSets {
+		if clusterSets[i].Namespace == "" {
+			clusterSets[i].Namespace = opts.NS
+		}
+
+		if clusterSets[i].Namespace == "" {
+			return nil, xerrors.Errorf("ClusterSet %q has no namespace: set either metadata.namespace or --namespace", clusterSets[i].Name)
+		}
+	}
+
+	priorities := map[string]int32{}
+
+	for _, cs := range clusterSets {
+		priorities[cs.Namespace+"/"+cs.Name] = cs.Spec.Priority
+	}
+
+	var configs []run.ClusterSetConfig
+
+	for i := range clusterSets {
+		clusterSet := &clusterSets[i]
+
+		config, err := NewConfig(clusterSet)
+		if err != nil {
+			return nil, xerrors.Errorf("ClusterSet %s/%s: %w", clusterSet.Namespace, clusterSet.Name, err)
+		}
+
+		config.ClusterSets = priorities
+		config.Log = opts.Log.WithValues("clusterSet", clusterSet.Namespace+"/"+clusterSet.Name)
+		config.DryRun = opts.DryRun || clusterSet.IsPaused()
+		config.Fixture = opts.Fixture
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// Sync syncs the ClusterSets the same as the controller does, except that nothing is written to their statuses.
+// Each ClusterSet is synced independently, and the first error is returned after all of them are synced.
+func Sync(clusterSets []v1beta1.ClusterSet, opts Options) error {
+	configs, err := Configs(clusterSets, opts)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+
+	for _, config := range configs {
+		log := config.Log
+
+		result, err := run.Sync(config)
+		if result != nil {
+			log.Info("Synced ClusterSet",
+				"dryRun", config.DryRun,
+				"clusters", len(result.Clusters),
+				"conflicts", len(result.Conflicts)+len(result.ClaimConflicts),
+				"created", result.Created,
+				"updated", result.Updated,
+				"deleted", result.Deleted,
+				"pendingCreations", result.PendingCreations,
+				"unreachable", result.Unreachable,
+			)
+		}
+
+		if err != nil {
+			log.Error(err, "Syncing ClusterSet")
+
+			if firstErr == nil {
+				firstErr = xerrors.Errorf("syncing ClusterSet %s/%s: %w", config.NS, config.Name, err)
+			}
+		}
+	}
+
+	return firstErr
+}
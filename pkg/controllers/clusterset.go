@@ -19,25 +19,44 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"github.com/mumoshu/argocd-clusterset/pkg/awsclicompat"
+	"github.com/mumoshu/argocd-clusterset/pkg/clusterset"
+	"github.com/mumoshu/argocd-clusterset/pkg/metrics"
 	"github.com/mumoshu/argocd-clusterset/pkg/run"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"golang.org/x/xerrors"
 	//"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
-	//metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/mumoshu/argocd-clusterset/api/v1alpha1"
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
 )
 
 const (
 	containerName = "runner"
 	finalizerName = "runner.clusterset.mumo.co"
+
+	// creatingClustersMinBackoff and creatingClustersMaxBackoff bound the interval of requeueing a ClusterSet
+	// while it waits for EKS clusters being created to become ACTIVE, which usually takes 10 minutes or more
+	creatingClustersMinBackoff = 30 * time.Second
+	creatingClustersMaxBackoff = 5 * time.Minute
 )
 
 // ClusterSetReconciler reconciles a ClusterSet object
@@ -46,6 +65,24 @@ type ClusterSetReconciler struct {
 	Log      logr.Logger
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+
+	// DefaultRefreshInterval is the interval between syncs of ClusterSets without spec.refreshInterval
+	DefaultRefreshInterval time.Duration
+
+	// DiscoveryCache is shared across all the ClusterSets. Clusters are discovered on every reconciliation when nil.
+	DiscoveryCache *run.DiscoveryCache
+
+	// AWSThrottle retries and rate-limits AWS API calls made for all the ClusterSets
+	AWSThrottle *awsclicompat.Throttle
+
+	// AllowedTargetNamespaces are the namespaces ClusterSets can write cluster secrets into other than their own.
+	// `*` allows all.
+	AllowedTargetNamespaces []string
+
+	eksEvents chan event.GenericEvent
+
+	creatingBackoffMu sync.Mutex
+	creatingBackoff   map[types.NamespacedName]time.Duration
 }
 
 // +kubebuilder:rbac:groups=clusterset.mumo.co,resources=clustersets,verbs=get;list;watch;create;update;patch;delete
@@ -59,7 +96,7 @@ func (r *ClusterSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	ctx := context.Background()
 	log := r.Log.WithValues("clusterSet", req.NamespacedName)
 
-	var clusterSet v1alpha1.ClusterSet
+	var clusterSet v1beta1.ClusterSet
 	if err := r.Get(ctx, req.NamespacedName, &clusterSet); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
@@ -76,7 +113,8 @@ func (r *ClusterSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 				return ctrl.Result{}, err
 			}
 
-			return ctrl.Result{}, nil
+			// The update doesn't change the generation, and is filtered out by the predicates. Requeue to sync the new ClusterSet.
+			return ctrl.Result{Requeue: true}, nil
 		}
 	} else {
 		finalizers, removed := removeFinalizer(clusterSet.ObjectMeta.Finalizers)
@@ -92,39 +130,391 @@ func (r *ClusterSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 				return ctrl.Result{}, err
 			}
 
+			metrics.DeleteClusterSet(clusterSet.Namespace, clusterSet.Name)
+			r.nextCreatingClustersBackoff(req.NamespacedName, false)
+
 			log.Info("Removed clusterSet")
 		}
 
 		return ctrl.Result{}, nil
 	}
 
-	config := run.ClusterSetConfig{
-		DryRun:  false,
-		NS:      req.Namespace,
-		EKSTags: clusterSet.Spec.Selector.EKSTags,
-		Labels:  clusterSet.Spec.Template.Metadata.Labels,
+	if ns, allowed := r.targetNamespacesAllowed(&clusterSet); !allowed {
+		msg := fmt.Sprintf("Target namespace %q is not allowed by --allowed-target-namespaces", ns)
+
+		if err := r.updateErrorStatus(ctx, &clusterSet, "TargetNamespaceNotAllowed", msg); err != nil {
+			log.Error(err, "Failed to update clusterSet status")
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	config, err := clusterset.NewConfig(&clusterSet)
+	if err != nil {
+		if err := r.updateErrorStatus(ctx, &clusterSet, "InvalidSpec", err.Error()); err != nil {
+			log.Error(err, "Failed to update clusterSet status")
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	// ClusterSets in any namespace can claim clusters in the shared target namespaces
+	var clusterSets v1beta1.ClusterSetList
+	if err := r.List(ctx, &clusterSets); err != nil {
+		log.Error(err, "Failed to list clusterSets")
+		return ctrl.Result{}, err
+	}
+
+	config.Cache = r.DiscoveryCache
+	config.ClusterSets = map[string]int32{}
+	for _, cs := range clusterSets.Items {
+		if cs.DeletionTimestamp.IsZero() {
+			config.ClusterSets[cs.Namespace+"/"+cs.Name] = cs.Spec.Priority
+		}
+	}
+	config.Throttle = r.AWSThrottle
+	config.Log = log
+	config.Events = &eventSink{recorder: r.Recorder, object: &clusterSet}
+
+	paused := clusterSet.IsPaused()
+	if paused {
+		// Compute the drift without making any change
+		config.DryRun = true
 	}
 
-	if err := run.Sync(config); err != nil {
+	result, err := run.Sync(config)
+	if result == nil {
 		log.Error(err, "Syncing clusters")
 
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+		// Let the rate-limited workqueue back off exponentially, so that retries don't make AWS API throttling worse
+		return ctrl.Result{}, err
+	}
+
+	var (
+		pruneRefused *run.PruneRefusedError
+		destErr      error
+	)
+
+	updated := clusterSet.DeepCopy()
+	updated.Status.Destinations = nil
+	for _, d := range result.Destinations {
+		status := v1beta1.ClusterSetDestinationStatus{
+			Namespace:        d.Destination.Namespace,
+			KubeconfigSecret: d.Destination.KubeconfigSecretName,
+			Phase:            "Synced",
+		}
+
+		var refused *run.PruneRefusedError
+
+		switch {
+		case d.Err == nil:
+		case xerrors.As(d.Err, &refused):
+			if pruneRefused == nil {
+				pruneRefused = refused
+			}
+
+			status.Phase = "Degraded"
+			status.Message = refused.Error()
+		default:
+			log.Error(d.Err, "Syncing destination", "destination", d.Destination.String())
+
+			if destErr == nil {
+				destErr = d.Err
+			}
+
+			status.Phase = "Error"
+			status.Message = d.Err.Error()
+		}
+
+		updated.Status.Destinations = append(updated.Status.Destinations, status)
+	}
+
+	for _, c := range result.Conflicts {
+		r.Recorder.Event(&clusterSet, corev1.EventTypeWarning, "Conflict", c.Message)
+	}
+
+	for _, c := range result.ClaimConflicts {
+		r.Recorder.Event(&clusterSet, corev1.EventTypeWarning, "Conflict", c.Message)
+	}
+
+	updated.Status.Clusters.Names = result.Clusters
+	updated.Status.Conflicts = nil
+	for _, c := range result.Conflicts {
+		updated.Status.Conflicts = append(updated.Status.Conflicts, v1beta1.ClusterSetConflict{
+			Server:   c.Server,
+			Clusters: c.Clusters,
+			Message:  c.Message,
+		})
+	}
+	updated.Status.LastSyncTime = metav1.Now()
+	updated.Status.PendingDeletions = nil
+	for _, d := range result.PendingDeletions {
+		updated.Status.PendingDeletions = append(updated.Status.PendingDeletions, v1beta1.ClusterSetPendingDeletion{
+			Name:         d.Name,
+			MissingSince: metav1.NewTime(d.MissingSince),
+		})
+	}
+
+	updated.Status.PendingClusters = result.PendingCreations
+	updated.Status.Connectivity = nil
+	for _, c := range result.Connectivity {
+		status := v1beta1.ClusterConnectivityStatus{
+			Name:          c.SecretName,
+			Server:        c.Server,
+			Reachable:     c.Err == nil,
+			Version:       c.Version,
+			LastCheckTime: metav1.NewTime(c.CheckedAt),
+		}
+
+		if c.Err != nil {
+			status.Message = c.Err.Error()
+		}
+
+		updated.Status.Connectivity = append(updated.Status.Connectivity, status)
+	}
+
+	// Renames and clusters registered under other names aren't waves of new clusters
+	if !paused && len(result.NewClusters) > 0 {
+		now := metav1.Now()
+		updated.Status.LastRolloutTime = &now
+	}
+
+	if pruneRefused != nil {
+		log.Info("Refused to prune cluster secrets", "deletions", pruneRefused.Deletions, "max", pruneRefused.Max)
+
+		r.Recorder.Event(&clusterSet, corev1.EventTypeWarning, "PruneRefused", pruneRefused.Error())
+
+		meta.SetStatusCondition(&updated.Status.Conditions, metav1.Condition{
+			Type:               v1beta1.ConditionTypeDegraded,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: clusterSet.Generation,
+			Reason:             "PruneRefused",
+			Message:            pruneRefused.Error(),
+		})
+	} else {
+		meta.SetStatusCondition(&updated.Status.Conditions, metav1.Condition{
+			Type:               v1beta1.ConditionTypeDegraded,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: clusterSet.Generation,
+			Reason:             "Synced",
+			Message:            "All the deletions were within the prune policy",
+		})
+	}
+
+	if len(result.ClaimConflicts) > 0 {
+		var owners []string
+		for _, c := range result.ClaimConflicts {
+			owners = append(owners, fmt.Sprintf("%s by %s", c.SecretName, c.Owner))
+		}
+
+		meta.SetStatusCondition(&updated.Status.Conditions, metav1.Condition{
+			Type:               v1beta1.ConditionTypeConflict,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: clusterSet.Generation,
+			Reason:             "ClaimedByOthers",
+			Message:            fmt.Sprintf("%d clusters are owned by other ClusterSets: %s", len(owners), strings.Join(owners, ", ")),
+		})
+	} else {
+		meta.SetStatusCondition(&updated.Status.Conditions, metav1.Condition{
+			Type:               v1beta1.ConditionTypeConflict,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: clusterSet.Generation,
+			Reason:             "NoConflict",
+			Message:            "No selected cluster is owned by other ClusterSets",
+		})
+	}
+
+	if paused {
+		updated.Status.Drift = &v1beta1.ClusterSetDrift{
+			Create: result.Created,
+			Update: result.Updated,
+			Delete: result.Deleted,
+		}
+		updated.Status.Phase = "Paused"
+		updated.Status.Reason = "Paused"
+		updated.Status.Message = fmt.Sprintf("Paused with %d clusters to create, %d to update and %d to delete", len(result.Created), len(result.Updated), len(result.Deleted))
+	} else if destErr != nil {
+		updated.Status.Drift = nil
+		updated.Status.Phase = "Error"
+		updated.Status.Reason = "DestinationFailed"
+		updated.Status.Message = destErr.Error()
+	} else if pruneRefused != nil {
+		updated.Status.Drift = nil
+		updated.Status.Phase = "Degraded"
+		updated.Status.Reason = "PruneRefused"
+		updated.Status.Message = pruneRefused.Error()
+	} else {
+		updated.Status.Drift = nil
+		updated.Status.Phase = "Synced"
+		updated.Status.Reason = "SyncFinished"
+		updated.Status.Message = fmt.Sprintf("Synced %d clusters with %d conflicts", len(result.Clusters), len(result.Conflicts))
+		if len(result.PendingCreations) > 0 {
+			updated.Status.Message += fmt.Sprintf(", with %d clusters pending rollout", len(result.PendingCreations))
+		}
+		if len(result.CreatingClusters) > 0 {
+			updated.Status.Message += fmt.Sprintf(", with %d EKS clusters being created", len(result.CreatingClusters))
+		}
+		if len(result.Unreachable) > 0 {
+			updated.Status.Message += fmt.Sprintf(", with %d unreachable clusters held back", len(result.Unreachable))
+		}
+	}
+
+	if err := r.Status().Update(ctx, updated); err != nil {
+		log.Error(err, "Failed to update clusterSet status")
+		return ctrl.Result{}, err
+	}
+
+	metrics.ClustersMatched.WithLabelValues(clusterSet.Namespace, clusterSet.Name).Set(float64(len(result.Clusters)))
+
+	if !paused && destErr == nil && pruneRefused == nil {
+		metrics.LastSuccessfulSync.WithLabelValues(clusterSet.Namespace, clusterSet.Name).SetToCurrentTime()
+	}
+
+	if destErr != nil {
+		r.Recorder.Event(&clusterSet, corev1.EventTypeWarning, "DestinationFailed", destErr.Error())
+
+		// Retry the failed destinations with backoff. The other destinations have been synced.
+		return ctrl.Result{}, destErr
+	}
+
+	if !paused && pruneRefused == nil {
+		r.Recorder.Event(&clusterSet, corev1.EventTypeNormal, "SyncFinished", fmt.Sprintf("Sync finished on '%s'", clusterSet.Name))
+	}
+
+	requeueAfter := r.refreshInterval(&clusterSet)
+
+	// Come back for the next wave of the pending clusters, rather than waiting for the next refresh
+	if len(result.PendingCreations) > 0 {
+		if next := time.Until(config.Rollout.NextWave()); next > 0 && next < requeueAfter {
+			requeueAfter = next
+		}
+	}
+
+	// Come back once the EKS clusters being created are likely to be ACTIVE, as there may be no notification for that
+	if backoff := r.nextCreatingClustersBackoff(req.NamespacedName, len(result.CreatingClusters) > 0); backoff > 0 && backoff < requeueAfter {
+		requeueAfter = backoff
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// nextCreatingClustersBackoff returns the interval of requeueing the ClusterSet waiting for EKS clusters being created,
+// doubling it on every call until it reaches creatingClustersMaxBackoff. It returns 0 and resets the backoff when not waiting.
+func (r *ClusterSetReconciler) nextCreatingClustersBackoff(key types.NamespacedName, waiting bool) time.Duration {
+	r.creatingBackoffMu.Lock()
+	defer r.creatingBackoffMu.Unlock()
+
+	if !waiting {
+		delete(r.creatingBackoff, key)
+
+		return 0
+	}
+
+	if r.creatingBackoff == nil {
+		r.creatingBackoff = map[types.NamespacedName]time.Duration{}
 	}
 
-	r.Recorder.Event(&clusterSet, corev1.EventTypeNormal, "SyncFinished", fmt.Sprintf("Sync finished on '%s'", clusterSet.Name))
+	backoff := r.creatingBackoff[key]
+	if backoff == 0 {
+		backoff = creatingClustersMinBackoff
+	} else if backoff *= 2; backoff > creatingClustersMaxBackoff {
+		backoff = creatingClustersMaxBackoff
+	}
+
+	r.creatingBackoff[key] = backoff
 
-	return ctrl.Result{}, nil
+	return backoff
+}
+
+// updateErrorStatus records the error that blocks syncing the ClusterSet until its spec changes, as an event and in its status
+func (r *ClusterSetReconciler) updateErrorStatus(ctx context.Context, clusterSet *v1beta1.ClusterSet, reason, msg string) error {
+	r.Recorder.Event(clusterSet, corev1.EventTypeWarning, reason, msg)
+
+	updated := clusterSet.DeepCopy()
+	updated.Status.Phase = "Error"
+	updated.Status.Reason = reason
+	updated.Status.Message = msg
+
+	return r.Status().Update(ctx, updated)
+}
+
+// targetNamespacesAllowed returns the first local target namespace not allowed by AllowedTargetNamespaces, if any.
+// The ClusterSet's own namespace is always allowed.
+func (r *ClusterSetReconciler) targetNamespacesAllowed(clusterSet *v1beta1.ClusterSet) (string, bool) {
+	targets := append([]string{}, clusterSet.Spec.TargetNamespaces...)
+
+	// Remote management clusters are out of the scope of the allowlist
+	for _, d := range clusterSet.Spec.Destinations {
+		if d.KubeconfigSecretRef == nil {
+			targets = append(targets, d.Namespace)
+		}
+	}
+
+	for _, ns := range targets {
+		if ns == clusterSet.Namespace {
+			continue
+		}
+
+		allowed := false
+
+		for _, a := range r.AllowedTargetNamespaces {
+			if a == "*" || a == ns {
+				allowed = true
+
+				break
+			}
+		}
+
+		if !allowed {
+			return ns, false
+		}
+	}
+
+	return "", true
+}
+
+func (r *ClusterSetReconciler) refreshInterval(clusterSet *v1beta1.ClusterSet) time.Duration {
+	if i := clusterSet.Spec.RefreshInterval; i != nil && i.Duration > 0 {
+		return i.Duration
+	}
+
+	return r.DefaultRefreshInterval
 }
 
 func (r *ClusterSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorderFor("clusterset-controller")
+	r.eksEvents = make(chan event.GenericEvent, 100)
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.ClusterSet{}).
+		// Ignore status updates made by the reconciler itself, while reacting to annotation changes like pausing
+		For(&v1beta1.ClusterSet{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, annotationsChangedPredicate))).
 		Owns(&corev1.Secret{}).
+		Watches(&source.Channel{Source: r.eksEvents}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
 
+// eventSink records the events emitted by run.Sync on the ClusterSet
+type eventSink struct {
+	recorder record.EventRecorder
+	object   runtime.Object
+}
+
+func (s *eventSink) Event(eventType, reason, message string) {
+	s.recorder.Event(s.object, eventType, reason, message)
+}
+
+var annotationsChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.MetaOld == nil || e.MetaNew == nil {
+			return false
+		}
+
+		return !reflect.DeepEqual(e.MetaOld.GetAnnotations(), e.MetaNew.GetAnnotations())
+	},
+}
+
 func addFinalizer(finalizers []string) ([]string, bool) {
 	exists := false
 	for _, name := range finalizers {
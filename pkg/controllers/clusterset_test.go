@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+)
+
+// secretsAPI is a stand-in for the Kubernetes API serving the secrets in a namespace from memory
+type secretsAPI struct {
+	mu      sync.Mutex
+	secrets map[string]corev1.Secret
+}
+
+func (a *secretsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 5 || parts[4] != "secrets" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var name string
+	if len(parts) > 5 {
+		name = parts[5]
+	}
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		list := corev1.SecretList{TypeMeta: metav1.TypeMeta{Kind: "SecretList", APIVersion: "v1"}}
+		for _, s := range a.secrets {
+			list.Items = append(list.Items, s)
+		}
+
+		_ = json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet:
+		s, ok := a.secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(s)
+	case r.Method == http.MethodPost || r.Method == http.MethodPut:
+		var s corev1.Secret
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &s); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for k, v := range s.StringData {
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+
+			s.Data[k] = []byte(v)
+		}
+
+		s.StringData = nil
+		a.secrets[s.Name] = s
+
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+
+		_ = json.NewEncoder(w).Encode(s)
+	case r.Method == http.MethodDelete:
+		delete(a.secrets, name)
+
+		fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Success"}`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// useKubeconfig points KUBECONFIG to the server for the duration of the test
+func useKubeconfig(t *testing.T, server string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`, server)
+
+	if err := ioutil.WriteFile(path, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	orig, ok := os.LookupEnv("KUBECONFIG")
+
+	os.Setenv("KUBECONFIG", path)
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("KUBECONFIG", orig)
+		} else {
+			os.Unsetenv("KUBECONFIG")
+		}
+	})
+}
+
+func newTestReconciler(objs ...runtime.Object) *ClusterSetReconciler {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1beta1.AddToScheme(scheme)
+
+	return &ClusterSetReconciler{
+		Client:                 fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:                    logrtesting.NullLogger{},
+		Recorder:               record.NewFakeRecorder(100),
+		Scheme:                 scheme,
+		DefaultRefreshInterval: time.Minute,
+	}
+}
+
+func TestReconcileGrandfatheredClusterSet(t *testing.T) {
+	inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items":[{"name":"prod-1","server":"https://prod-1.example.com"}]}`)
+	}))
+	defer inventory.Close()
+
+	api := &secretsAPI{secrets: map[string]corev1.Secret{}}
+
+	apiServer := httptest.NewServer(api)
+	defer apiServer.Close()
+
+	useKubeconfig(t, apiServer.URL)
+
+	// Admitted before the validation for namePrefix was added, which ValidateCreate rejects
+	clusterSet := &v1beta1.ClusterSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "cmdb", Finalizers: []string{finalizerName}},
+		Spec: v1beta1.ClusterSetSpec{
+			Selectors: []v1beta1.ClusterSelector{
+				{HTTP: &v1beta1.HTTPClusterSelector{
+					URL:    inventory.URL,
+					Fields: v1beta1.HTTPClusterFields{Name: "{.name}", Server: "{.server}"},
+				}},
+			},
+			Template: v1beta1.ClusterSecretTemplate{NameStrategy: "prefixed"},
+		},
+	}
+
+	if clusterSet.ValidateCreate() == nil {
+		t.Fatalf("expected the ClusterSet to fail the current validation")
+	}
+
+	r := newTestReconciler(clusterSet)
+
+	key := types.NamespacedName{Namespace: "argocd", Name: "cmdb"}
+
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got v1beta1.ClusterSet
+
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatalf("getting ClusterSet: %v", err)
+	}
+
+	if got.Status.Phase != "Synced" {
+		t.Errorf("expected the grandfathered ClusterSet to be synced, got %s: %s", got.Status.Phase, got.Status.Message)
+	}
+
+	if _, ok := api.secrets["prod-1"]; !ok {
+		t.Errorf("expected the cluster secret to be created, got %v", api.secrets)
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+	"github.com/mumoshu/argocd-clusterset/pkg/eksevents"
+	"golang.org/x/xerrors"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// HandleEKSEvent enqueues the ClusterSets that might select or have selected the cluster the event is for,
+// so that they are reconciled immediately instead of waiting for the next periodic resync.
+func (r *ClusterSetReconciler) HandleEKSEvent(ev eksevents.Event) error {
+	if r.DiscoveryCache != nil {
+		r.DiscoveryCache.Invalidate(ev.Account, ev.Region)
+	}
+
+	var list v1beta1.ClusterSetList
+
+	if err := r.List(context.Background(), &list); err != nil {
+		return xerrors.Errorf("listing clustersets: %w", err)
+	}
+
+	var dropped int
+
+	for i := range list.Items {
+		cs := &list.Items[i]
+
+		if !selectsEKSClustersIn(cs, ev.Account, ev.Region) {
+			continue
+		}
+
+		r.Log.Info("Enqueueing clusterSet for EKS lifecycle notification", "clusterSet", cs.Namespace+"/"+cs.Name, "event", ev.Name, "cluster", ev.ClusterName)
+
+		// Never block the SQS poller on a busy controller. The notification is redelivered after its visibility timeout instead.
+		select {
+		case r.eksEvents <- event.GenericEvent{Meta: cs, Object: cs}:
+		default:
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		return xerrors.Errorf("enqueueing %d clustersets for %s of %s: event channel is full", dropped, ev.Name, ev.ClusterName)
+	}
+
+	return nil
+}
+
+func selectsEKSClustersIn(cs *v1beta1.ClusterSet, account, region string) bool {
+	selectors := cs.Spec.Selectors
+
+	// All the EKS clusters are selected when there's no selector
+	if len(selectors) == 0 {
+		selectors = append(selectors, v1beta1.ClusterSelector{})
+	}
+
+	if cs.Spec.Exclude != nil {
+		selectors = append(selectors, *cs.Spec.Exclude)
+	}
+
+	for _, sel := range selectors {
+		if sel.HTTP != nil || sel.OCM != nil || sel.Karmada != nil {
+			continue
+		}
+
+		eks := sel.EKS
+		if eks == nil {
+			eks = &v1beta1.EKSClusterSelector{}
+		}
+
+		if eks.Region != "" && region != "" && eks.Region != region {
+			continue
+		}
+
+		if eks.RoleARN != "" && account != "" {
+			if parsed, err := arn.Parse(eks.RoleARN); err == nil && parsed.AccountID != account {
+				continue
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
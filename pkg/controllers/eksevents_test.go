@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/mumoshu/argocd-clusterset/api/v1beta1"
+	"github.com/mumoshu/argocd-clusterset/pkg/eksevents"
+)
+
+func TestHandleEKSEventDoesNotBlock(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+
+	clusterSet := func(name string) runtime.Object {
+		return &v1beta1.ClusterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: name},
+			Spec:       v1beta1.ClusterSetSpec{MatchAll: true},
+		}
+	}
+
+	r := &ClusterSetReconciler{
+		Client:    fake.NewFakeClientWithScheme(scheme, clusterSet("a"), clusterSet("b")),
+		Log:       logrtesting.NullLogger{},
+		eksEvents: make(chan event.GenericEvent, 1),
+	}
+
+	done := make(chan error)
+
+	go func() {
+		done <- r.HandleEKSEvent(eksevents.Event{Name: eksevents.EventNameCreateCluster, ClusterName: "prod-1", Region: "us-east-2"})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected an error for the ClusterSet that couldn't be enqueued, so that the notification is redelivered")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("HandleEKSEvent blocked on the full event channel")
+	}
+
+	if n := len(r.eksEvents); n != 1 {
+		t.Errorf("expected 1 enqueued ClusterSet, got %d", n)
+	}
+}
+
+func TestNextCreatingClustersBackoff(t *testing.T) {
+	r := &ClusterSetReconciler{}
+
+	key := types.NamespacedName{Namespace: "argocd", Name: "prod"}
+
+	var got []time.Duration
+
+	for i := 0; i < 6; i++ {
+		got = append(got, r.nextCreatingClustersBackoff(key, true))
+	}
+
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected backoffs: want %v, got %v", want, got)
+		}
+	}
+
+	if b := r.nextCreatingClustersBackoff(key, false); b != 0 {
+		t.Errorf("expected no backoff when no cluster is being created, got %v", b)
+	}
+
+	if b := r.nextCreatingClustersBackoff(key, true); b != creatingClustersMinBackoff {
+		t.Errorf("expected the backoff to be reset, got %v", b)
+	}
+}
@@ -0,0 +1,148 @@
+package eksevents
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-logr/logr"
+	"github.com/mumoshu/argocd-clusterset/pkg/awsclicompat"
+	"golang.org/x/xerrors"
+)
+
+const (
+	EventNameCreateCluster = "CreateCluster"
+	EventNameDeleteCluster = "DeleteCluster"
+
+	// waitTimeSeconds is the maximum allowed duration of SQS long polling
+	waitTimeSeconds = 20
+)
+
+// Event is the notification of an EKS cluster being created or deleted
+type Event struct {
+	// Name is either of EventNameCreateCluster or EventNameDeleteCluster
+	Name        string
+	ClusterName string
+	Region      string
+	Account     string
+}
+
+// Poller receives EKS lifecycle notifications from an SQS queue fed by an EventBridge rule that matches
+// the CloudTrail events of `eks.amazonaws.com`, and passes them to the Handler.
+//
+// Poller implements sigs.k8s.io/controller-runtime/pkg/manager.Runnable.
+type Poller struct {
+	QueueURL string
+	// Endpoint overrides the SQS endpoint, so that a local SQS-compatible server can be used for testing.
+	Endpoint string
+	Region   string
+	Handler  func(Event) error
+	Log      logr.Logger
+}
+
+// eventBridgeEvent is the subset of an EventBridge event that carries an EKS API call recorded by CloudTrail
+type eventBridgeEvent struct {
+	Source  string `json:"source"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+	Detail  struct {
+		EventName         string `json:"eventName"`
+		RequestParameters struct {
+			Name string `json:"name"`
+		} `json:"requestParameters"`
+	} `json:"detail"`
+}
+
+func (p *Poller) Start(stop <-chan struct{}) error {
+	cfg := aws.NewConfig()
+	if p.Endpoint != "" {
+		cfg = cfg.WithEndpoint(p.Endpoint)
+	}
+
+	client := sqs.New(awsclicompat.NewSession(p.Region, ""), cfg)
+
+	p.Log.Info("Starting to poll EKS lifecycle notifications", "queueURL", p.QueueURL)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if err := p.poll(client); err != nil {
+			p.Log.Error(err, "Polling EKS lifecycle notifications")
+
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+}
+
+func (p *Poller) poll(client *sqs.SQS) error {
+	result, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(p.QueueURL),
+		MaxNumberOfMessages: aws.Int64(10),
+		WaitTimeSeconds:     aws.Int64(waitTimeSeconds),
+	})
+	if err != nil {
+		return xerrors.Errorf("receiving messages: %w", err)
+	}
+
+	for _, m := range result.Messages {
+		ev, err := ParseEvent(aws.StringValue(m.Body))
+		if err != nil {
+			// Drop the message to prevent it from being redelivered forever
+			p.Log.Error(err, "Ignoring malformed message", "messageId", aws.StringValue(m.MessageId))
+		} else if ev != nil {
+			p.Log.Info("Received EKS lifecycle notification", "event", ev.Name, "cluster", ev.ClusterName, "region", ev.Region, "account", ev.Account)
+
+			if err := p.Handler(*ev); err != nil {
+				// Leave the message in the queue so that it's redelivered after the visibility timeout
+				p.Log.Error(err, "Handling EKS lifecycle notification", "messageId", aws.StringValue(m.MessageId))
+
+				continue
+			}
+		}
+
+		if _, err := client.DeleteMessage(&sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(p.QueueURL),
+			ReceiptHandle: m.ReceiptHandle,
+		}); err != nil {
+			return xerrors.Errorf("deleting message %s: %w", aws.StringValue(m.MessageId), err)
+		}
+	}
+
+	return nil
+}
+
+// ParseEvent parses the body of an SQS message sent by EventBridge.
+// It returns nil without an error when the message is not a CreateCluster or DeleteCluster call.
+func ParseEvent(body string) (*Event, error) {
+	var e eventBridgeEvent
+
+	if err := json.Unmarshal([]byte(body), &e); err != nil {
+		return nil, xerrors.Errorf("decoding event: %w", err)
+	}
+
+	if e.Source != "aws.eks" {
+		return nil, nil
+	}
+
+	switch e.Detail.EventName {
+	case EventNameCreateCluster, EventNameDeleteCluster:
+	default:
+		return nil, nil
+	}
+
+	return &Event{
+		Name:        e.Detail.EventName,
+		ClusterName: e.Detail.RequestParameters.Name,
+		Region:      e.Region,
+		Account:     e.Account,
+	}, nil
+}
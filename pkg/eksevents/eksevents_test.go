@@ -0,0 +1,212 @@
+package eksevents
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	"golang.org/x/xerrors"
+)
+
+func TestParseEvent(t *testing.T) {
+	testcases := map[string]struct {
+		body    string
+		want    *Event
+		invalid bool
+	}{
+		"create": {
+			body: `{"source":"aws.eks","account":"123456789012","region":"us-east-2","detail":{"eventName":"CreateCluster","requestParameters":{"name":"prod-1"}}}`,
+			want: &Event{Name: EventNameCreateCluster, ClusterName: "prod-1", Region: "us-east-2", Account: "123456789012"},
+		},
+		"delete": {
+			body: `{"source":"aws.eks","account":"123456789012","region":"eu-west-1","detail":{"eventName":"DeleteCluster","requestParameters":{"name":"prod-2"}}}`,
+			want: &Event{Name: EventNameDeleteCluster, ClusterName: "prod-2", Region: "eu-west-1", Account: "123456789012"},
+		},
+		"malformed": {
+			body:    `{"source":`,
+			invalid: true,
+		},
+		"other source": {
+			body: `{"source":"aws.ec2","detail":{"eventName":"CreateCluster"}}`,
+		},
+		"other event": {
+			body: `{"source":"aws.eks","detail":{"eventName":"UpdateClusterConfig","requestParameters":{"name":"prod-1"}}}`,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseEvent(tc.body)
+
+			if tc.invalid {
+				if err == nil {
+					t.Errorf("expected error, got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+type sqsMessage struct {
+	MessageId     string
+	ReceiptHandle string
+	MD5OfBody     string
+	Body          string
+}
+
+// sqsQueue is a stand-in for the SQS query API serving the messages once, and recording the deleted receipt handles
+type sqsQueue struct {
+	mu       sync.Mutex
+	messages []sqsMessage
+	deleted  []string
+}
+
+func (q *sqsQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+
+	switch r.Form.Get("Action") {
+	case "ReceiveMessage":
+		res := struct {
+			XMLName  xml.Name     `xml:"ReceiveMessageResponse"`
+			Messages []sqsMessage `xml:"ReceiveMessageResult>Message"`
+		}{Messages: q.messages}
+
+		q.messages = nil
+
+		_ = xml.NewEncoder(w).Encode(res)
+	case "DeleteMessage":
+		q.deleted = append(q.deleted, r.Form.Get("ReceiptHandle"))
+
+		fmt.Fprint(w, `<DeleteMessageResponse><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></DeleteMessageResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (q *sqsQueue) deletedHandles() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]string{}, q.deleted...)
+}
+
+func newSQSMessage(id, body string) sqsMessage {
+	sum := md5.Sum([]byte(body))
+
+	return sqsMessage{MessageId: id, ReceiptHandle: "receipt-" + id, MD5OfBody: hex.EncodeToString(sum[:]), Body: body}
+}
+
+func setenv(t *testing.T, key, value string) {
+	orig, ok := os.LookupEnv(key)
+
+	os.Setenv(key, value)
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, orig)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestPoller(t *testing.T) {
+	setenv(t, "AWS_ACCESS_KEY_ID", "test")
+	setenv(t, "AWS_SECRET_ACCESS_KEY", "test")
+
+	queue := &sqsQueue{
+		messages: []sqsMessage{
+			newSQSMessage("create", `{"source":"aws.eks","account":"123456789012","region":"us-east-2","detail":{"eventName":"CreateCluster","requestParameters":{"name":"prod-1"}}}`),
+			newSQSMessage("malformed", `{"source":`),
+			newSQSMessage("unrelated", `{"source":"aws.eks","detail":{"eventName":"UpdateClusterConfig"}}`),
+			newSQSMessage("failing", `{"source":"aws.eks","account":"123456789012","region":"us-east-2","detail":{"eventName":"DeleteCluster","requestParameters":{"name":"prod-2"}}}`),
+		},
+	}
+
+	server := httptest.NewServer(queue)
+	defer server.Close()
+
+	var (
+		mu      sync.Mutex
+		handled []Event
+	)
+
+	p := &Poller{
+		QueueURL: server.URL + "/123456789012/eks-events",
+		Endpoint: server.URL,
+		Region:   "us-east-2",
+		Log:      logrtesting.NullLogger{},
+		Handler: func(ev Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			handled = append(handled, ev)
+
+			if ev.Name == EventNameDeleteCluster {
+				return xerrors.New("event channel is full")
+			}
+
+			return nil
+		},
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error)
+
+	go func() {
+		done <- p.Start(stop)
+	}()
+
+	// The failing message is never deleted
+	want := []string{"receipt-create", "receipt-malformed", "receipt-unrelated"}
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for len(queue.deletedHandles()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if got := queue.deletedHandles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected deleted messages: want %v, got %v", want, got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(handled) != 2 || handled[0].ClusterName != "prod-1" || handled[1].ClusterName != "prod-2" {
+		t.Errorf("unexpected handled events: %+v", handled)
+	}
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mumoshu/argocd-clusterset/pkg/awsclicompat"
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// defaultSTSRegion is the region of the global STS endpoint
+const defaultSTSRegion = "us-east-1"
+
+// AWSCredentials returns a checker that fails unless the AWS credentials are valid, by calling STS GetCallerIdentity.
+// STS in the region is called, which defaults to the region the session is configured with via the environment or
+// the shared config, or defaultSTSRegion when none.
+// The result is cached for the interval so that frequent probes don't call STS every time.
+func AWSCredentials(region, endpoint string, interval time.Duration) healthz.Checker {
+	sess := awsclicompat.NewSession(region, "")
+
+	cfg := aws.NewConfig()
+	if aws.StringValue(sess.Config.Region) == "" {
+		cfg = cfg.WithRegion(defaultSTSRegion)
+	}
+
+	if endpoint != "" {
+		cfg = cfg.WithEndpoint(endpoint)
+	}
+
+	stsClient := sts.New(sess, cfg)
+
+	check := func() error {
+		if _, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{}); err != nil {
+			return xerrors.Errorf("calling sts:GetCallerIdentity: %w", err)
+		}
+
+		return nil
+	}
+
+	return cached(interval, check)
+}
+
+// Kubernetes returns a checker that fails unless the Kubernetes API server is reachable
+func Kubernetes(client discovery.DiscoveryInterface, interval time.Duration) healthz.Checker {
+	check := func() error {
+		if _, err := client.ServerVersion(); err != nil {
+			return xerrors.Errorf("getting Kubernetes API server version: %w", err)
+		}
+
+		return nil
+	}
+
+	return cached(interval, check)
+}
+
+// ColdCache reports the keys of the cache entries being fetched for the first time, like *run.DiscoveryCache
+type ColdCache interface {
+	Cold() []string
+}
+
+// DiscoveryCache returns a checker that fails until the first discoveries of all the clusters requested by ClusterSets complete.
+// Discovery errors don't fail it, as they are specific to the ClusterSets.
+func DiscoveryCache(cache ColdCache) healthz.Checker {
+	return func(_ *http.Request) error {
+		if cold := cache.Cold(); len(cold) > 0 {
+			return xerrors.Errorf("discovery cache is not warm yet for %s", strings.Join(cold, ", "))
+		}
+
+		return nil
+	}
+}
+
+// cached returns a checker that runs the check at most once per interval, returning the last result in between
+func cached(interval time.Duration, check func() error) healthz.Checker {
+	var (
+		mu        sync.Mutex
+		lastErr   error
+		checkedAt time.Time
+	)
+
+	return func(_ *http.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if checkedAt.IsZero() || time.Since(checkedAt) >= interval {
+			lastErr = check()
+			checkedAt = time.Now()
+		}
+
+		return lastErr
+	}
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mumoshu/argocd-clusterset/pkg/run"
+)
+
+func TestCached(t *testing.T) {
+	var (
+		calls int
+		err   error
+	)
+
+	check := cached(50*time.Millisecond, func() error {
+		calls++
+		return err
+	})
+
+	err = errors.New("unreachable")
+
+	if got := check(nil); got != err {
+		t.Errorf("expected the check error to be returned, got %v", got)
+	}
+
+	err = nil
+
+	if got := check(nil); got == nil || calls != 1 {
+		t.Errorf("expected the last result to be returned within the interval, got %v after %d calls", got, calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if got := check(nil); got != nil || calls != 2 {
+		t.Errorf("expected the check to run again after the interval, got %v after %d calls", got, calls)
+	}
+}
+
+func setenv(t *testing.T, key, value string) {
+	orig, ok := os.LookupEnv(key)
+
+	os.Setenv(key, value)
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, orig)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestAWSCredentials(t *testing.T) {
+	setenv(t, "AWS_ACCESS_KEY_ID", "test")
+	setenv(t, "AWS_SECRET_ACCESS_KEY", "test")
+	setenv(t, "AWS_REGION", "eu-west-1")
+
+	var (
+		mu     sync.Mutex
+		scopes []string
+	)
+
+	valid := true
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// The credential scope in the signature is ACCESS_KEY/DATE/REGION/SERVICE/aws4_request
+		scopes = append(scopes, r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "text/xml")
+
+		if !valid {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidClientTokenId</Code><Message>The security token included in the request is invalid.</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+
+			return
+		}
+
+		fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Arn>arn:aws:iam::123456789012:user/test</Arn><UserId>test</UserId><Account>123456789012</Account></GetCallerIdentityResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`)
+	}))
+	defer sts.Close()
+
+	testcases := map[string]struct {
+		region string
+		want   string
+	}{
+		"configured region": {want: "/eu-west-1/sts/"},
+		"region":            {region: "ap-northeast-1", want: "/ap-northeast-1/sts/"},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			mu.Lock()
+			scopes = nil
+			mu.Unlock()
+
+			if err := AWSCredentials(tc.region, sts.URL, time.Minute)(nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(scopes) != 1 || !strings.Contains(scopes[0], tc.want) {
+				t.Errorf("expected STS to be called in %s, got %v", tc.want, scopes)
+			}
+		})
+	}
+
+	mu.Lock()
+	valid = false
+	mu.Unlock()
+
+	if err := AWSCredentials("", sts.URL, time.Minute)(nil); err == nil {
+		t.Errorf("expected the invalid credentials to fail the check")
+	}
+}
+
+type coldCache []string
+
+func (c coldCache) Cold() []string {
+	return c
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	if err := DiscoveryCache(run.NewDiscoveryCache(time.Minute, nil))(nil); err != nil {
+		t.Errorf("expected the empty cache to be warm, got %v", err)
+	}
+
+	err := DiscoveryCache(coldCache{"eks account=123456789012 region=us-east-2"})(nil)
+	if err == nil || !strings.Contains(err.Error(), "region=us-east-2") {
+		t.Errorf("expected the cold entry to fail the check, got %v", err)
+	}
+}
@@ -3,14 +3,22 @@ package manager
 import (
 	"flag"
 	"github.com/spf13/pflag"
+	"strings"
 	"time"
 
 	clustersetv1alpha1 "github.com/mumoshu/argocd-clusterset/api/v1alpha1"
+	clustersetv1beta1 "github.com/mumoshu/argocd-clusterset/api/v1beta1"
+	"github.com/mumoshu/argocd-clusterset/pkg/awsclicompat"
 	"github.com/mumoshu/argocd-clusterset/pkg/controllers"
+	"github.com/mumoshu/argocd-clusterset/pkg/eksevents"
+	"github.com/mumoshu/argocd-clusterset/pkg/health"
+	"github.com/mumoshu/argocd-clusterset/pkg/run"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// +kubebuilder:scaffold:imports
 )
@@ -24,29 +32,98 @@ func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 
 	_ = clustersetv1alpha1.AddToScheme(scheme)
+	_ = clustersetv1beta1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 type Manager struct {
 	MetricsAddr          string
+	HealthProbeAddr      string
 	EnableLeaderElection bool
 	SyncPeriod           time.Duration
+
+	// EKSEventsQueueURL is the URL of the SQS queue that receives EKS lifecycle notifications from EventBridge.
+	// ClusterSets are reconciled only periodically when empty.
+	EKSEventsQueueURL string
+	EKSEventsEndpoint string
+	EKSEventsRegion   string
+
+	// DiscoveryCacheTTL is how long discovered clusters are shared across ClusterSets before being discovered again.
+	// Clusters are discovered on every reconciliation when zero.
+	DiscoveryCacheTTL time.Duration
+
+	AWSMaxRetries       int
+	AWSMinThrottleDelay time.Duration
+	AWSMaxThrottleDelay time.Duration
+	AWSAPIQPS           float64
+	AWSAPIBurst         int
+	// AWSAPIQPSOverrides is comma-separated ACCOUNT/REGION=QPS or REGION=QPS pairs
+	AWSAPIQPSOverrides string
+
+	// AllowedTargetNamespaces is the comma-separated namespaces ClusterSets can write cluster secrets into
+	AllowedTargetNamespaces string
+
+	EnableWebhooks bool
+
+	// ReadinessCheckAWSCredentials makes the readiness depend on the AWS credentials of the controller being valid
+	ReadinessCheckAWSCredentials bool
+	// AWSSTSEndpoint overrides the STS endpoint called by the readiness check to validate AWS credentials
+	AWSSTSEndpoint string
+	// AWSSTSRegion is the region of the STS endpoint called by the readiness check.
+	// Defaults to the region the controller is configured with, or us-east-1 when none.
+	AWSSTSRegion string
+	// ReadinessCheckInterval is the minimum interval between the calls to AWS and Kubernetes APIs made by the readiness checks
+	ReadinessCheckInterval time.Duration
 }
 
 func (m *Manager) AddFlags(fs flag.FlagSet) {
 	fs.StringVar(&m.MetricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	fs.StringVar(&m.HealthProbeAddr, "health-probe-addr", ":8081", "The address the /healthz and /readyz endpoints bind to.")
 	fs.BoolVar(&m.EnableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	fs.DurationVar(&m.SyncPeriod, "sync-period", 30*time.Second, "Determines the minimum frequency at which K8s resources managed by this controller are reconciled.")
+	fs.StringVar(&m.EKSEventsQueueURL, "eks-events-queue-url", "", "URL of the SQS queue that receives EKS CreateCluster/DeleteCluster notifications from EventBridge. Affected ClusterSets are reconciled immediately on notification when set.")
+	fs.StringVar(&m.EKSEventsEndpoint, "eks-events-sqs-endpoint", "", "Overrides the SQS endpoint used to receive EKS lifecycle notifications, like a local SQS-compatible server for testing.")
+	fs.StringVar(&m.EKSEventsRegion, "eks-events-region", "", "AWS region of the SQS queue that receives EKS lifecycle notifications. Defaults to the region the controller is configured with.")
+	fs.DurationVar(&m.DiscoveryCacheTTL, "discovery-cache-ttl", 30*time.Second, "How long clusters discovered per account and region are shared across ClusterSets before being discovered again. Set 0 to discover on every reconciliation.")
+	fs.IntVar(&m.AWSMaxRetries, "aws-max-retries", 8, "Maximum number of retries for each AWS API call")
+	fs.DurationVar(&m.AWSMinThrottleDelay, "aws-min-throttle-delay", 500*time.Millisecond, "Minimum delay of the exponential backoff with jitter of AWS API calls retried on throttling errors")
+	fs.DurationVar(&m.AWSMaxThrottleDelay, "aws-max-throttle-delay", 60*time.Second, "Maximum delay of the exponential backoff with jitter of AWS API calls retried on throttling errors")
+	fs.Float64Var(&m.AWSAPIQPS, "aws-api-qps", 10, "Number of AWS API calls allowed per second per account and region. Set 0 to disable client-side rate limiting.")
+	fs.IntVar(&m.AWSAPIBurst, "aws-api-burst", 20, "Number of AWS API calls allowed in a burst per account and region")
+	fs.StringVar(&m.AWSAPIQPSOverrides, "aws-api-qps-overrides", "", "Comma-separated ACCOUNT/REGION=QPS, /REGION=QPS or REGION=QPS pairs that override --aws-api-qps per account and region. ACCOUNT/REGION applies to accounts accessed via role ARNs, and /REGION to the controller's own account")
+	fs.StringVar(&m.AllowedTargetNamespaces, "allowed-target-namespaces", "", "Comma-separated namespaces of Argo CD instances that ClusterSets in other namespaces can write cluster secrets into via spec.targetNamespaces. Set * to allow all.")
+	fs.BoolVar(&m.EnableWebhooks, "enable-webhooks", false, "Serve the validating and defaulting webhooks for ClusterSet on port 9443. Requires a serving certificate in /tmp/k8s-webhook-server/serving-certs.")
+	fs.BoolVar(&m.ReadinessCheckAWSCredentials, "readiness-check-aws-credentials", false, "Fail the readiness check unless the AWS credentials of the controller are valid, by calling sts:GetCallerIdentity. Leave it disabled when ClusterSets assume roles only, or select no EKS clusters.")
+	fs.StringVar(&m.AWSSTSEndpoint, "aws-sts-endpoint", "", "Overrides the STS endpoint called by the readiness check enabled by --readiness-check-aws-credentials, like a regional or VPC endpoint.")
+	fs.StringVar(&m.AWSSTSRegion, "aws-sts-region", "", "AWS region of the STS endpoint called by the readiness check enabled by --readiness-check-aws-credentials. Defaults to the region the controller is configured with, or us-east-1 when none.")
+	fs.DurationVar(&m.ReadinessCheckInterval, "readiness-check-interval", 30*time.Second, "Minimum interval between the AWS and Kubernetes API calls made by the readiness checks. Probes in between return the last result.")
 
 	//	flag.Parse()
 }
 
 func (m *Manager) AddPFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&m.MetricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	fs.StringVar(&m.HealthProbeAddr, "health-probe-addr", ":8081", "The address the /healthz and /readyz endpoints bind to.")
 	fs.BoolVar(&m.EnableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	fs.DurationVar(&m.SyncPeriod, "sync-period", 30*time.Second, "Determines the minimum frequency at which K8s resources managed by this controller are reconciled.")
+	fs.StringVar(&m.EKSEventsQueueURL, "eks-events-queue-url", "", "URL of the SQS queue that receives EKS CreateCluster/DeleteCluster notifications from EventBridge. Affected ClusterSets are reconciled immediately on notification when set.")
+	fs.StringVar(&m.EKSEventsEndpoint, "eks-events-sqs-endpoint", "", "Overrides the SQS endpoint used to receive EKS lifecycle notifications, like a local SQS-compatible server for testing.")
+	fs.StringVar(&m.EKSEventsRegion, "eks-events-region", "", "AWS region of the SQS queue that receives EKS lifecycle notifications. Defaults to the region the controller is configured with.")
+	fs.DurationVar(&m.DiscoveryCacheTTL, "discovery-cache-ttl", 30*time.Second, "How long clusters discovered per account and region are shared across ClusterSets before being discovered again. Set 0 to discover on every reconciliation.")
+	fs.IntVar(&m.AWSMaxRetries, "aws-max-retries", 8, "Maximum number of retries for each AWS API call")
+	fs.DurationVar(&m.AWSMinThrottleDelay, "aws-min-throttle-delay", 500*time.Millisecond, "Minimum delay of the exponential backoff with jitter of AWS API calls retried on throttling errors")
+	fs.DurationVar(&m.AWSMaxThrottleDelay, "aws-max-throttle-delay", 60*time.Second, "Maximum delay of the exponential backoff with jitter of AWS API calls retried on throttling errors")
+	fs.Float64Var(&m.AWSAPIQPS, "aws-api-qps", 10, "Number of AWS API calls allowed per second per account and region. Set 0 to disable client-side rate limiting.")
+	fs.IntVar(&m.AWSAPIBurst, "aws-api-burst", 20, "Number of AWS API calls allowed in a burst per account and region")
+	fs.StringVar(&m.AWSAPIQPSOverrides, "aws-api-qps-overrides", "", "Comma-separated ACCOUNT/REGION=QPS, /REGION=QPS or REGION=QPS pairs that override --aws-api-qps per account and region. ACCOUNT/REGION applies to accounts accessed via role ARNs, and /REGION to the controller's own account")
+	fs.StringVar(&m.AllowedTargetNamespaces, "allowed-target-namespaces", "", "Comma-separated namespaces of Argo CD instances that ClusterSets in other namespaces can write cluster secrets into via spec.targetNamespaces. Set * to allow all.")
+	fs.BoolVar(&m.EnableWebhooks, "enable-webhooks", false, "Serve the validating and defaulting webhooks for ClusterSet on port 9443. Requires a serving certificate in /tmp/k8s-webhook-server/serving-certs.")
+	fs.BoolVar(&m.ReadinessCheckAWSCredentials, "readiness-check-aws-credentials", false, "Fail the readiness check unless the AWS credentials of the controller are valid, by calling sts:GetCallerIdentity. Leave it disabled when ClusterSets assume roles only, or select no EKS clusters.")
+	fs.StringVar(&m.AWSSTSEndpoint, "aws-sts-endpoint", "", "Overrides the STS endpoint called by the readiness check enabled by --readiness-check-aws-credentials, like a regional or VPC endpoint.")
+	fs.StringVar(&m.AWSSTSRegion, "aws-sts-region", "", "AWS region of the STS endpoint called by the readiness check enabled by --readiness-check-aws-credentials. Defaults to the region the controller is configured with, or us-east-1 when none.")
+	fs.DurationVar(&m.ReadinessCheckInterval, "readiness-check-interval", 30*time.Second, "Minimum interval between the AWS and Kubernetes API calls made by the readiness checks. Probes in between return the last result.")
 
 	//	flag.Parse()
 }
@@ -56,6 +133,11 @@ func (m *Manager) Run() error {
 		err error
 	)
 
+	qpsOverrides, err := awsclicompat.ParseQPSOverrides(m.AWSAPIQPSOverrides)
+	if err != nil {
+		return err
+	}
+
 	logger := zap.New(func(o *zap.Options) {
 		o.Development = true
 	})
@@ -63,12 +145,13 @@ func (m *Manager) Run() error {
 	ctrl.SetLogger(logger)
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: m.MetricsAddr,
-		LeaderElection:     m.EnableLeaderElection,
-		LeaderElectionID:   "clusterset",
-		Port:               9443,
-		SyncPeriod:         &m.SyncPeriod,
+		Scheme:                 scheme,
+		MetricsBindAddress:     m.MetricsAddr,
+		HealthProbeBindAddress: m.HealthProbeAddr,
+		LeaderElection:         m.EnableLeaderElection,
+		LeaderElectionID:       "clusterset",
+		Port:                   9443,
+		SyncPeriod:             &m.SyncPeriod,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -76,9 +159,23 @@ func (m *Manager) Run() error {
 	}
 
 	clusterSetReconciler := &controllers.ClusterSetReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ClusterSet"),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("ClusterSet"),
+		Scheme:                  mgr.GetScheme(),
+		DefaultRefreshInterval:  m.SyncPeriod,
+		AllowedTargetNamespaces: splitCommaSeparated(m.AllowedTargetNamespaces),
+		AWSThrottle: &awsclicompat.Throttle{
+			MaxRetries:       m.AWSMaxRetries,
+			MinThrottleDelay: m.AWSMinThrottleDelay,
+			MaxThrottleDelay: m.AWSMaxThrottleDelay,
+			QPS:              m.AWSAPIQPS,
+			Burst:            m.AWSAPIBurst,
+			QPSOverrides:     qpsOverrides,
+		},
+	}
+
+	if m.DiscoveryCacheTTL > 0 {
+		clusterSetReconciler.DiscoveryCache = run.NewDiscoveryCache(m.DiscoveryCacheTTL, ctrl.Log.WithName("discoverycache"))
 	}
 
 	if err = clusterSetReconciler.SetupWithManager(mgr); err != nil {
@@ -86,6 +183,34 @@ func (m *Manager) Run() error {
 		return err
 	}
 
+	if m.EnableWebhooks {
+		// Serves the conversion webhook between v1alpha1 and v1beta1, too
+		if err = (&clustersetv1beta1.ClusterSet{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterSet")
+			return err
+		}
+	}
+
+	if err := m.addHealthChecks(mgr, clusterSetReconciler.DiscoveryCache); err != nil {
+		setupLog.Error(err, "unable to set up health checks")
+		return err
+	}
+
+	if m.EKSEventsQueueURL != "" {
+		poller := &eksevents.Poller{
+			QueueURL: m.EKSEventsQueueURL,
+			Endpoint: m.EKSEventsEndpoint,
+			Region:   m.EKSEventsRegion,
+			Handler:  clusterSetReconciler.HandleEKSEvent,
+			Log:      ctrl.Log.WithName("eksevents"),
+		}
+
+		if err := mgr.Add(poller); err != nil {
+			setupLog.Error(err, "unable to add EKS lifecycle notification poller")
+			return err
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -96,3 +221,47 @@ func (m *Manager) Run() error {
 
 	return nil
 }
+
+// addHealthChecks serves /healthz that passes as long as the manager is running,
+// and /readyz that passes once the controller can reach Kubernetes API and has attempted the first discoveries.
+// The AWS credentials are checked only when enabled, as the controller is useful without them.
+func (m *Manager) addHealthChecks(mgr ctrl.Manager, cache *run.DiscoveryCache) error {
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
+
+	if m.ReadinessCheckAWSCredentials {
+		if err := mgr.AddReadyzCheck("aws-credentials", health.AWSCredentials(m.AWSSTSRegion, m.AWSSTSEndpoint, m.ReadinessCheckInterval)); err != nil {
+			return err
+		}
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.AddReadyzCheck("kubernetes", health.Kubernetes(discoveryClient, m.ReadinessCheckInterval)); err != nil {
+		return err
+	}
+
+	if cache != nil {
+		if err := mgr.AddReadyzCheck("discovery-cache", health.DiscoveryCache(cache)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func splitCommaSeparated(s string) []string {
+	var values []string
+
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
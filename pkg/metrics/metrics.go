@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "clusterset"
+
+	LabelProvider   = "provider"
+	LabelAccount    = "account"
+	LabelRegion     = "region"
+	LabelService    = "service"
+	LabelOperation  = "operation"
+	LabelCode       = "code"
+	LabelNamespace  = "namespace"
+	LabelClusterSet = "clusterset"
+	LabelResult     = "result"
+
+	// Values of LabelResult of ClusterSecretOperations
+	ResultCreated = "created"
+	ResultUpdated = "updated"
+	ResultDeleted = "deleted"
+	ResultFailed  = "failed"
+)
+
+var (
+	// DiscoveryCacheHits counts the discoveries served from the shared discovery cache
+	DiscoveryCacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "discovery_cache_hits_total",
+			Help:      "Number of cluster discoveries served from the shared discovery cache",
+		},
+		[]string{LabelProvider, LabelAccount, LabelRegion},
+	)
+
+	// DiscoveryCacheMisses counts the discoveries that called the provider API because the cache was empty or expired
+	DiscoveryCacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "discovery_cache_misses_total",
+			Help:      "Number of cluster discoveries that called the provider API because the shared discovery cache was empty or expired",
+		},
+		[]string{LabelProvider, LabelAccount, LabelRegion},
+	)
+
+	// DiscoveryDuration observes how long it took to discover clusters from the provider API, excluding cache hits
+	DiscoveryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "discovery_duration_seconds",
+			Help:      "Time taken to discover clusters from the provider API",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{LabelProvider, LabelAccount, LabelRegion},
+	)
+
+	// AWSAPICalls counts the AWS API calls per service like `eks` and `sts`, each of which can be made of multiple retried requests
+	AWSAPICalls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "aws_api_calls_total",
+			Help:      "Number of AWS API calls by service and operation",
+		},
+		[]string{LabelService, LabelOperation, LabelAccount, LabelRegion},
+	)
+
+	// AWSAPIErrors counts the AWS API calls that failed after all the retries, by the AWS error code
+	AWSAPIErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "aws_api_errors_total",
+			Help:      "Number of AWS API calls failed after retries by service, operation and error code",
+		},
+		[]string{LabelService, LabelOperation, LabelAccount, LabelRegion, LabelCode},
+	)
+
+	// ClustersMatched is the number of clusters selected by each ClusterSet in the last sync
+	ClustersMatched = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "clusters_matched",
+			Help:      "Number of clusters selected by the ClusterSet in the last sync",
+		},
+		[]string{LabelNamespace, LabelClusterSet},
+	)
+
+	// ClusterSecretOperations counts the cluster secrets created, updated, deleted, or failed to be, per ClusterSet.
+	// Dry runs aren't counted.
+	ClusterSecretOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cluster_secret_operations_total",
+			Help:      "Number of cluster secrets created, updated, deleted or failed to be by the ClusterSet",
+		},
+		[]string{LabelNamespace, LabelClusterSet, LabelResult},
+	)
+
+	// PruneRefusals counts the syncs whose deletions were refused by the prune policy
+	PruneRefusals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prune_refusals_total",
+			Help:      "Number of times the prune policy refused to delete cluster secrets of the ClusterSet",
+		},
+		[]string{LabelNamespace, LabelClusterSet},
+	)
+
+	// LastSuccessfulSync is the Unix time of the last sync of each ClusterSet finished without any error
+	LastSuccessfulSync = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_sync_timestamp_seconds",
+			Help:      "Unix time of the last sync of the ClusterSet finished without any error",
+		},
+		[]string{LabelNamespace, LabelClusterSet},
+	)
+)
+
+// DeleteClusterSet removes the series of the deleted ClusterSet
+func DeleteClusterSet(ns, name string) {
+	ClustersMatched.DeleteLabelValues(ns, name)
+	PruneRefusals.DeleteLabelValues(ns, name)
+	LastSuccessfulSync.DeleteLabelValues(ns, name)
+
+	for _, r := range []string{ResultCreated, ResultUpdated, ResultDeleted, ResultFailed} {
+		ClusterSecretOperations.DeleteLabelValues(ns, name, r)
+	}
+}
+
+func init() {
+	metrics.Registry.MustRegister(
+		DiscoveryCacheHits,
+		DiscoveryCacheMisses,
+		DiscoveryDuration,
+		AWSAPICalls,
+		AWSAPIErrors,
+		ClustersMatched,
+		ClusterSecretOperations,
+		PruneRefusals,
+		LastSuccessfulSync,
+	)
+}
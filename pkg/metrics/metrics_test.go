@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestRegistered(t *testing.T) {
+	DiscoveryDuration.WithLabelValues("eks", "111111111111", "us-east-2").Observe(0.3)
+	AWSAPICalls.WithLabelValues("eks", "ListClusters", "111111111111", "us-east-2").Inc()
+	AWSAPIErrors.WithLabelValues("eks", "ListClusters", "111111111111", "us-east-2", "ThrottlingException").Inc()
+
+	want := `
+# HELP clusterset_aws_api_calls_total Number of AWS API calls by service and operation
+# TYPE clusterset_aws_api_calls_total counter
+clusterset_aws_api_calls_total{account="111111111111",operation="ListClusters",region="us-east-2",service="eks"} 1
+# HELP clusterset_aws_api_errors_total Number of AWS API calls failed after retries by service, operation and error code
+# TYPE clusterset_aws_api_errors_total counter
+clusterset_aws_api_errors_total{account="111111111111",code="ThrottlingException",operation="ListClusters",region="us-east-2",service="eks"} 1
+# HELP clusterset_discovery_duration_seconds Time taken to discover clusters from the provider API
+# TYPE clusterset_discovery_duration_seconds histogram
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="0.1"} 0
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="0.25"} 0
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="0.5"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="1"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="2.5"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="5"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="10"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="30"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="60"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="120"} 1
+clusterset_discovery_duration_seconds_bucket{account="111111111111",provider="eks",region="us-east-2",le="+Inf"} 1
+clusterset_discovery_duration_seconds_sum{account="111111111111",provider="eks",region="us-east-2"} 0.3
+clusterset_discovery_duration_seconds_count{account="111111111111",provider="eks",region="us-east-2"} 1
+`
+
+	// The metrics are served from the controller-runtime registry on --metrics-addr
+	err := testutil.GatherAndCompare(metrics.Registry, strings.NewReader(want),
+		"clusterset_aws_api_calls_total",
+		"clusterset_aws_api_errors_total",
+		"clusterset_discovery_duration_seconds",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// series returns the number of series collected from the collector
+func series(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 100)
+
+	c.Collect(ch)
+	close(ch)
+
+	return len(ch)
+}
+
+func TestDeleteClusterSet(t *testing.T) {
+	ClustersMatched.WithLabelValues("argocd", "prod").Set(3)
+	ClusterSecretOperations.WithLabelValues("argocd", "prod", ResultCreated).Inc()
+	PruneRefusals.WithLabelValues("argocd", "prod").Inc()
+	LastSuccessfulSync.WithLabelValues("argocd", "prod").SetToCurrentTime()
+
+	ClustersMatched.WithLabelValues("argocd", "staging").Set(2)
+
+	DeleteClusterSet("argocd", "prod")
+
+	testcases := map[string]struct {
+		count int
+		want  int
+	}{
+		"clusters matched":          {count: series(ClustersMatched), want: 1},
+		"cluster secret operations": {count: series(ClusterSecretOperations), want: 0},
+		"prune refusals":            {count: series(PruneRefusals), want: 0},
+		"last successful sync":      {count: series(LastSuccessfulSync), want: 0},
+	}
+
+	for name, tc := range testcases {
+		if tc.count != tc.want {
+			t.Errorf("%s: expected %d series, got %d", name, tc.want, tc.count)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package run
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mumoshu/argocd-clusterset/pkg/metrics"
+)
+
+// DiscoveryCache caches discovered clusters per provider, account and region, so that all the ClusterSets selecting
+// clusters from the same account and region share a single set of provider API calls per TTL.
+// The zero value is not usable. Use NewDiscoveryCache instead.
+type DiscoveryCache struct {
+	ttl time.Duration
+	log logr.Logger
+
+	mu      sync.Mutex
+	entries map[discoveryCacheKey]*discoveryCacheEntry
+}
+
+type discoveryCacheKey struct {
+	Provider string
+	Account  string
+	Region   string
+	// RoleARN is part of the key because clusters discovered via different roles are rendered differently,
+	// even when the roles are in the same account
+	RoleARN string
+}
+
+func (k discoveryCacheKey) String() string {
+	return k.Provider + " account=" + k.Account + " region=" + k.Region
+}
+
+type discoveryCacheEntry struct {
+	// mu is held while the clusters are being fetched, so that concurrent discoveries for the same key
+	// wait for the single in-flight fetch instead of calling the provider API on their own
+	mu        sync.Mutex
+	clusters  []Cluster
+	fetchedAt time.Time
+
+	// warm is true once the first fetch completes, whether it succeeded or not. Guarded by DiscoveryCache.mu, not mu,
+	// so that Cold doesn't wait for in-flight fetches.
+	warm bool
+}
+
+// NewDiscoveryCache returns a cache whose entries expire after the ttl
+func NewDiscoveryCache(ttl time.Duration, log logr.Logger) *DiscoveryCache {
+	return &DiscoveryCache{
+		ttl:     ttl,
+		log:     logOrDiscard(log),
+		entries: map[discoveryCacheKey]*discoveryCacheEntry{},
+	}
+}
+
+func (c *DiscoveryCache) get(key discoveryCacheKey, fetch func() ([]Cluster, error)) ([]Cluster, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &discoveryCacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if !entry.fetchedAt.IsZero() && time.Since(entry.fetchedAt) < c.ttl {
+		metrics.DiscoveryCacheHits.WithLabelValues(key.Provider, key.Account, key.Region).Inc()
+
+		return entry.clusters, nil
+	}
+
+	metrics.DiscoveryCacheMisses.WithLabelValues(key.Provider, key.Account, key.Region).Inc()
+
+	clusters, err := fetch()
+
+	c.mu.Lock()
+	entry.warm = true
+	c.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry.clusters = clusters
+
+	// Clusters being created become usable in minutes, which the ClusterSets waiting for them must notice without waiting for the TTL
+	if !anyCreating(clusters) {
+		entry.fetchedAt = time.Now()
+	}
+
+	return clusters, nil
+}
+
+func anyCreating(clusters []Cluster) bool {
+	for _, c := range clusters {
+		if c.Creating {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cold returns the keys of the entries being fetched for the first time. The cache is warm when none.
+// Entries failing to be fetched aren't cold, as the errors are specific to the ClusterSets requesting them,
+// like a wrong role or region, and reported on them.
+func (c *DiscoveryCache) Cold() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var cold []string
+
+	for key, entry := range c.entries {
+		if !entry.warm {
+			cold = append(cold, key.String())
+		}
+	}
+
+	sort.Strings(cold)
+
+	return cold
+}
+
+// Invalidate expires the entries for the account and region, so that the next discovery calls the provider API.
+// An empty account or region matches any.
+func (c *DiscoveryCache) Invalidate(account, region string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if (account == "" || key.Account == "" || key.Account == account) && (region == "" || key.Region == "" || key.Region == region) {
+			c.log.Info("Invalidating discovery cache", "provider", key.Provider, "account", key.Account, "region", key.Region)
+
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package run
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryCacheCold(t *testing.T) {
+	cache := NewDiscoveryCache(time.Minute, nil)
+
+	ok := discoveryCacheKey{Provider: ProviderEKS, Account: "123456789012", Region: "us-east-2"}
+	failing := discoveryCacheKey{Provider: ProviderEKS, Account: "123456789012", Region: "eu-west-1"}
+
+	fetching := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, _ = cache.get(ok, func() ([]Cluster, error) {
+			<-fetching
+			return []Cluster{{Name: "prod-1"}}, nil
+		})
+	}()
+
+	// Wait for the first fetch to start
+	for len(cache.Cold()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if cold := cache.Cold(); len(cold) != 1 || cold[0] != ok.String() {
+		t.Errorf("expected the entry being fetched to be cold, got %v", cold)
+	}
+
+	close(fetching)
+	<-done
+
+	if _, err := cache.get(failing, func() ([]Cluster, error) { return nil, errors.New("access denied") }); err == nil {
+		t.Fatalf("expected the fetch error to be returned")
+	}
+
+	if cold := cache.Cold(); len(cold) != 0 {
+		t.Errorf("expected the cache to be warm after the first fetches regardless of their errors, got %v", cold)
+	}
+
+	clusters, err := cache.get(ok, func() ([]Cluster, error) {
+		t.Fatalf("unexpected fetch of the cached entry")
+		return nil, nil
+	})
+	if err != nil || len(clusters) != 1 {
+		t.Errorf("unexpected cached clusters: %v, %v", clusters, err)
+	}
+}
+
+func TestDiscoveryCacheCreating(t *testing.T) {
+	cache := NewDiscoveryCache(time.Minute, nil)
+
+	key := discoveryCacheKey{Provider: ProviderEKS, Account: "123456789012", Region: "us-east-2"}
+
+	var fetches int
+
+	fetch := func() ([]Cluster, error) {
+		fetches++
+		return []Cluster{{Name: "prod-1", Creating: fetches == 1}}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.get(key, fetch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if fetches != 2 {
+		t.Errorf("expected the clusters to be refetched only while one is being created, got %d fetches", fetches)
+	}
+}
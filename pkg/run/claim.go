@@ -0,0 +1,109 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// ClaimConflict describes a cluster that another ClusterSet has already claimed with an equal or higher priority.
+// The cluster is left to the other ClusterSet.
+type ClaimConflict struct {
+	// SecretName is the name of the cluster secret this ClusterSet wanted to create or update
+	SecretName string
+	Server     string
+	// Owner is the name of the ClusterSet that owns the cluster secret for the cluster
+	Owner   string
+	Message string
+}
+
+// ownedByOther returns the live ClusterSet other than this one that owns the cluster secret, if any.
+// The owner is qualified like `NAMESPACE/NAME`, the same as the keys of ClusterSets.
+// Cluster secrets owned by deleted ClusterSets are treated as orphans that any ClusterSet can adopt.
+func (c ClusterSetConfig) ownedByOther(secret corev1.Secret) (string, bool) {
+	owner := secret.Annotations[SecretAnnotationKeyClusterSet]
+	if owner == "" {
+		return "", false
+	}
+
+	// Cluster secrets written into the ClusterSet's own namespace are annotated with the unqualified name
+	if !strings.Contains(owner, "/") {
+		owner = secret.Namespace + "/" + owner
+	}
+
+	if owner == c.NS+"/"+c.Name {
+		return "", false
+	}
+
+	if _, alive := c.ClusterSets[owner]; !alive {
+		return "", false
+	}
+
+	return owner, true
+}
+
+// resolveClaims drops the desired cluster secrets for the clusters claimed by other ClusterSets that win over this one.
+// A ClusterSet with the higher priority wins, and the current owner wins a tie.
+func resolveClaims(kubeclient typedcorev1.SecretInterface, config ClusterSetConfig, objects []*corev1.Secret) ([]*corev1.Secret, []ClaimConflict, error) {
+	if config.Name == "" || config.ClusterSets == nil {
+		return objects, nil, nil
+	}
+
+	current, err := listClusterSecrets(kubeclient, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Both the cluster secret of the same name and the ones for the same server are claims on the cluster
+	byName := map[string]corev1.Secret{}
+	byServer := map[string][]corev1.Secret{}
+
+	for _, item := range current.Items {
+		key := serverKey(string(item.Data["server"]))
+
+		byName[item.Name] = item
+		byServer[key] = append(byServer[key], item)
+	}
+
+	var (
+		claimed   []*corev1.Secret
+		conflicts []ClaimConflict
+	)
+
+	for _, obj := range objects {
+		server := obj.StringData["server"]
+
+		claims := byServer[serverKey(server)]
+
+		if existing, ok := byName[obj.Name]; ok {
+			claims = append([]corev1.Secret{existing}, claims...)
+		}
+
+		var owner string
+
+		for _, existing := range claims {
+			if o, ok := config.ownedByOther(existing); ok {
+				owner = o
+
+				break
+			}
+		}
+
+		if owner == "" || config.Priority > config.ClusterSets[owner] {
+			claimed = append(claimed, obj)
+
+			continue
+		}
+
+		conflicts = append(conflicts, ClaimConflict{
+			SecretName: obj.Name,
+			Server:     server,
+			Owner:      owner,
+			Message:    fmt.Sprintf("cluster %s is already claimed by ClusterSet %q with priority %d, which is equal to or higher than %d", server, owner, config.ClusterSets[owner], config.Priority),
+		})
+	}
+
+	return claimed, conflicts, nil
+}
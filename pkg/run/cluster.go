@@ -0,0 +1,157 @@
+package run
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Cluster is the provider-neutral description of a discovered cluster
+// that a cluster secret is rendered from.
+// It's also the normalized cluster record in provider fixtures.
+type Cluster struct {
+	// Name is the name of the cluster shown in Argo CD.
+	Name string `json:"name"`
+	// SecretName is the name of the cluster secret, computed from the other fields according to the name strategy
+	SecretName string `json:"-"`
+	// Server is the URL of the Kubernetes API server
+	Server string `json:"server"`
+	// CAData is the base64-encoded CA certificate of the API server
+	CAData string `json:"caData,omitempty"`
+	// AWSClusterName is set when Argo CD should authenticate against the cluster using the EKS cluster name
+	AWSClusterName string `json:"awsClusterName,omitempty"`
+	// AWSRoleARN is the IAM role Argo CD assumes to authenticate against the EKS cluster
+	AWSRoleARN string `json:"awsRoleARN,omitempty"`
+	// BearerToken is set when Argo CD should authenticate against the cluster using the token
+	BearerToken string `json:"bearerToken,omitempty"`
+	// Insecure disables the verification of the API server certificate
+	Insecure bool `json:"insecure,omitempty"`
+	// ServerName is the name the API server certificate is verified against, when it differs from the host of Server
+	ServerName string `json:"serverName,omitempty"`
+	// ARN is the ARN of the EKS cluster
+	ARN string `json:"arn,omitempty"`
+	// AWSAccount is the ID of the AWS account the EKS cluster is in
+	AWSAccount string `json:"awsAccount,omitempty"`
+	// AWSRegion is the AWS region the EKS cluster is in
+	AWSRegion string `json:"awsRegion,omitempty"`
+	// Version is the Kubernetes version of the cluster
+	Version string `json:"version,omitempty"`
+	// PlatformVersion is the EKS platform version of the cluster
+	PlatformVersion string `json:"platformVersion,omitempty"`
+	// CreatedAt is when the cluster was created
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	// EndpointPublicAccess is true when the API server is reachable from the internet
+	EndpointPublicAccess bool `json:"endpointPublicAccess,omitempty"`
+	// EndpointPrivateAccess is true when the API server is reachable from within the VPC
+	EndpointPrivateAccess bool `json:"endpointPrivateAccess,omitempty"`
+	// PublicAccessCIDRs are the CIDRs allowed to reach the public endpoint of the API server
+	PublicAccessCIDRs []string `json:"publicAccessCIDRs,omitempty"`
+	// Labels are provider-specific attributes used for selecting clusters, like EKS tags
+	Labels map[string]string `json:"labels,omitempty"`
+	// Selector describes the selector that selected the cluster
+	Selector string `json:"-"`
+	// Provider is the provider the cluster was discovered from, which is either of ProviderEKS, ProviderHTTP, ProviderOCM or ProviderKarmada
+	Provider string `json:"provider,omitempty"`
+	// Creating is true for the EKS clusters being created, which have no endpoint yet and are never registered
+	Creating bool `json:"-"`
+	// KeepExisting is true for the clusters whose credentials can't be read. No cluster secret is rendered for them,
+	// and their existing cluster secrets are kept as they are, so that a transient failure never deletes them.
+	KeepExisting bool `json:"-"`
+}
+
+// EndpointAccess returns how the API server is reachable, which is either of
+// `public`, `private`, `public-and-private`, or an empty string when unknown.
+func (c Cluster) EndpointAccess() string {
+	switch {
+	case c.EndpointPublicAccess && c.EndpointPrivateAccess:
+		return "public-and-private"
+	case c.EndpointPublicAccess:
+		return "public"
+	case c.EndpointPrivateAccess:
+		return "private"
+	default:
+		return ""
+	}
+}
+
+// annotations returns the annotations that record the identity and the metadata of the cluster on the cluster secret
+func (c Cluster) annotations() map[string]string {
+	annotations := map[string]string{}
+
+	var createdAt string
+
+	if c.CreatedAt != nil {
+		createdAt = c.CreatedAt.UTC().Format(time.RFC3339)
+	}
+
+	for k, v := range map[string]string{
+		SecretAnnotationKeyClusterName:       c.Name,
+		SecretAnnotationKeyClusterARN:        c.ARN,
+		SecretAnnotationKeyAWSAccount:        c.AWSAccount,
+		SecretAnnotationKeyAWSRegion:         c.AWSRegion,
+		SecretAnnotationKeyKubernetesVersion: c.Version,
+		SecretAnnotationKeyPlatformVersion:   c.PlatformVersion,
+		SecretAnnotationKeyCreatedAt:         createdAt,
+		SecretAnnotationKeyEndpointAccess:    c.EndpointAccess(),
+		SecretAnnotationKeyPublicAccessCIDRs: strings.Join(c.PublicAccessCIDRs, ","),
+	} {
+		if v != "" {
+			annotations[k] = v
+		}
+	}
+
+	return annotations
+}
+
+type clusterConfig struct {
+	BearerToken     string          `json:"bearerToken,omitempty"`
+	AWSAuthConfig   *awsAuthConfig  `json:"awsAuthConfig,omitempty"`
+	TLSClientConfig tlsClientConfig `json:"tlsClientConfig"`
+}
+
+type awsAuthConfig struct {
+	ClusterName string `json:"clusterName"`
+	RoleARN     string `json:"roleARN,omitempty"`
+}
+
+type tlsClientConfig struct {
+	Insecure   bool   `json:"insecure"`
+	ServerName string `json:"serverName,omitempty"`
+	CAData     string `json:"caData,omitempty"`
+}
+
+// argocdClusterConfig renders the `config` field of the Argo CD cluster secret for the cluster
+func argocdClusterConfig(cluster Cluster) string {
+	config := clusterConfig{
+		BearerToken: cluster.BearerToken,
+		TLSClientConfig: tlsClientConfig{
+			Insecure:   cluster.Insecure,
+			ServerName: cluster.ServerName,
+			CAData:     cluster.CAData,
+		},
+	}
+
+	if cluster.AWSClusterName != "" {
+		config.AWSAuthConfig = &awsAuthConfig{
+			ClusterName: cluster.AWSClusterName,
+			RoleARN:     cluster.AWSRoleARN,
+		}
+	}
+
+	text, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return string(text) + "\n"
+}
+
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,202 @@
+package run
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultConnectivityTimeout is the timeout of the check of each cluster when ConnectivityConfig.Timeout is zero
+	DefaultConnectivityTimeout = 10 * time.Second
+
+	// connectivityConcurrency is the maximum number of clusters checked at once
+	connectivityConcurrency = 10
+
+	EventReasonClusterUnreachable = "ClusterUnreachable"
+)
+
+// ConnectivityConfig verifies that the selected clusters are reachable the way Argo CD connects to them
+type ConnectivityConfig struct {
+	// Enabled checks every selected cluster on each sync
+	Enabled bool
+	// SkipUnreachable holds back the cluster secrets of unreachable clusters. Existing cluster secrets are kept either way.
+	SkipUnreachable bool
+	// Timeout is the timeout of the check of each cluster. Defaults to DefaultConnectivityTimeout.
+	Timeout time.Duration
+}
+
+// ConnectivityResult is the outcome of the connectivity check of a cluster
+type ConnectivityResult struct {
+	SecretName string
+	Server     string
+	// Version is the Kubernetes version returned by the `/version` endpoint
+	Version string
+	// Err is why the cluster is unreachable. The cluster is reachable when nil.
+	Err       error
+	CheckedAt time.Time
+}
+
+// checkConnectivity checks all the clusters concurrently, and returns the results in the order of the clusters
+func checkConnectivity(config ConnectivityConfig, clusters []Cluster) []ConnectivityResult {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConnectivityTimeout
+	}
+
+	results := make([]ConnectivityResult, len(clusters))
+
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, connectivityConcurrency)
+
+	for i := range clusters {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			c := clusters[i]
+
+			version, err := verifyCluster(c, timeout)
+
+			results[i] = ConnectivityResult{
+				SecretName: c.SecretName,
+				Server:     c.Server,
+				Version:    version,
+				Err:        err,
+				CheckedAt:  time.Now(),
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// verifyCluster performs a TLS handshake against the API server of the cluster with the discovered CA,
+// and calls the `/version` endpoint authenticated like Argo CD does. It returns the Kubernetes version of the cluster.
+func verifyCluster(cluster Cluster, timeout time.Duration) (string, error) {
+	u, err := url.Parse(cluster.Server)
+	if err != nil {
+		return "", xerrors.Errorf("parsing server URL %q: %w", cluster.Server, err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cluster.Insecure,
+	}
+
+	if cluster.ServerName != "" {
+		tlsConfig.ServerName = cluster.ServerName
+	}
+
+	if cluster.CAData != "" {
+		ca, err := base64.StdEncoding.DecodeString(cluster.CAData)
+		if err != nil {
+			return "", xerrors.Errorf("decoding CA data: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return "", xerrors.Errorf("no valid certificate found in CA data")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	if err != nil {
+		return "", xerrors.Errorf("TLS handshake with %s: %w", addr, err)
+	}
+
+	conn.Close()
+
+	token, err := clusterToken(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(cluster.Server, "/")+"/version", nil)
+	if err != nil {
+		return "", xerrors.Errorf("creating request: %w", err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("calling /version: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("calling /version: unexpected status %s", res.Status)
+	}
+
+	var info struct {
+		GitVersion string `json:"gitVersion"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return "", xerrors.Errorf("decoding /version: %w", err)
+	}
+
+	return info.GitVersion, nil
+}
+
+// clusterToken returns the bearer token Argo CD would authenticate against the cluster with, if any
+func clusterToken(cluster Cluster) (string, error) {
+	if cluster.BearerToken != "" {
+		return cluster.BearerToken, nil
+	}
+
+	if cluster.AWSClusterName != "" {
+		token, err := eksToken(cluster.AWSClusterName, cluster.AWSRegion, cluster.AWSRoleARN)
+		if err != nil {
+			return "", xerrors.Errorf("getting EKS token for %s: %w", cluster.AWSClusterName, err)
+		}
+
+		return token, nil
+	}
+
+	return "", nil
+}
+
+// unreachable returns the error of the connectivity check of the cluster of the cluster secret, when it's to be held back
+func (c ClusterSetConfig) unreachable(secret *corev1.Secret) error {
+	if !c.Connectivity.SkipUnreachable {
+		return nil
+	}
+
+	return c.unreachableClusters[secret.Name]
+}
@@ -0,0 +1,88 @@
+package run
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyCluster(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprint(w, `{"gitVersion":"v1.18.9-eks-d1db3c"}`)
+	}))
+	defer server.Close()
+
+	ca := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	testcases := map[string]struct {
+		cluster Cluster
+		version string
+		err     string
+	}{
+		"trusted": {
+			cluster: Cluster{Server: server.URL, CAData: ca, BearerToken: "token"},
+			version: "v1.18.9-eks-d1db3c",
+		},
+		"trusted with server name": {
+			cluster: Cluster{Server: server.URL, CAData: ca, BearerToken: "token", ServerName: "example.com"},
+			version: "v1.18.9-eks-d1db3c",
+		},
+		"insecure": {
+			cluster: Cluster{Server: server.URL, Insecure: true, BearerToken: "token"},
+			version: "v1.18.9-eks-d1db3c",
+		},
+		"untrusted": {
+			cluster: Cluster{Server: server.URL, BearerToken: "token"},
+			err:     "TLS handshake",
+		},
+		"wrong server name": {
+			cluster: Cluster{Server: server.URL, CAData: ca, BearerToken: "token", ServerName: "kubernetes.invalid"},
+			err:     "TLS handshake",
+		},
+		"unauthorized": {
+			cluster: Cluster{Server: server.URL, CAData: ca, BearerToken: "wrong"},
+			err:     "unexpected status 401",
+		},
+		"invalid CA data": {
+			cluster: Cluster{Server: server.URL, CAData: base64.StdEncoding.EncodeToString([]byte("invalid"))},
+			err:     "no valid certificate",
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			version, err := verifyCluster(tc.cluster, 5*time.Second)
+
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if version != tc.version {
+				t.Errorf("unexpected version: want %q, got %q", tc.version, version)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package run
+
+import (
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DestinationConfig is an Argo CD instance the cluster secrets are written into
+type DestinationConfig struct {
+	// Namespace is the namespace of the Argo CD instance
+	Namespace string
+	// KubeconfigSecretName is the name of the secret in the ClusterSet's namespace containing the kubeconfig for
+	// the remote management cluster the Argo CD instance runs on. The local cluster is used when empty.
+	KubeconfigSecretName string
+}
+
+// String returns `NAMESPACE` for local destinations, and `KUBECONFIG_SECRET:NAMESPACE` for remote ones
+func (d DestinationConfig) String() string {
+	if d.KubeconfigSecretName == "" {
+		return d.Namespace
+	}
+
+	return d.KubeconfigSecretName + ":" + d.Namespace
+}
+
+// DestinationResult is the outcome of a sync for a destination
+type DestinationResult struct {
+	Destination DestinationConfig
+	// Err is why the destination failed to sync, which can be a *PruneRefusedError
+	Err error
+}
+
+// destinations returns the destinations of the cluster secrets, which default to NS
+func (c ClusterSetConfig) destinations() []DestinationConfig {
+	var dests []DestinationConfig
+
+	for _, ns := range c.TargetNamespaces {
+		dests = append(dests, DestinationConfig{Namespace: ns})
+	}
+
+	dests = append(dests, c.Destinations...)
+
+	if len(dests) == 0 {
+		dests = append(dests, DestinationConfig{Namespace: c.NS})
+	}
+
+	return dests
+}
+
+// destinationClientset returns the clientset for the cluster the destination is on
+func destinationClientset(clientset kubernetes.Interface, ns string, dest DestinationConfig) (kubernetes.Interface, error) {
+	if dest.KubeconfigSecretName == "" {
+		return clientset, nil
+	}
+
+	config, err := restConfigFromSecret(clientset, ns, dest.KubeconfigSecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, xerrors.Errorf("creating clientset for destination %s: %w", dest, err)
+	}
+
+	return remote, nil
+}
@@ -0,0 +1,249 @@
+package run
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/go-logr/logr"
+	"github.com/mumoshu/argocd-clusterset/pkg/awsclicompat"
+	"golang.org/x/xerrors"
+)
+
+const (
+	eksClusterIDHeader    = "x-k8s-aws-id"
+	eksTokenPrefix        = "k8s-aws-v1."
+	eksTokenPresignExpiry = 60 * time.Second
+)
+
+// newEKSClient returns an EKS client for the region, which assumes the role when roleARN is not empty.
+// API calls are retried and rate-limited by the throttle when it's not nil.
+func newEKSClient(region, roleARN string, throttle *awsclicompat.Throttle) *eks.EKS {
+	sess := awsclicompat.NewSession(region, "")
+
+	var (
+		cfgs    []*aws.Config
+		account string
+	)
+
+	if throttle != nil {
+		cfgs = append(cfgs, throttle.Config())
+	}
+
+	if roleARN != "" {
+		cfgs = append(cfgs, &aws.Config{Credentials: stscreds.NewCredentials(sess, roleARN)})
+
+		if parsed, err := arn.Parse(roleARN); err == nil {
+			account = parsed.AccountID
+		}
+	}
+
+	eksClient := eks.New(sess, cfgs...)
+
+	if throttle != nil {
+		throttle.Limit(eksClient.Client, account)
+	}
+
+	awsclicompat.Instrument(eksClient.Client, account)
+
+	return eksClient
+}
+
+func eksClusters(log logr.Logger, config SelectorConfig, cache *DiscoveryCache, throttle *awsclicompat.Throttle) ([]Cluster, error) {
+	var (
+		all []Cluster
+		err error
+	)
+
+	key := newEKSCacheKey(config.EKSRegion, config.EKSRoleARN)
+
+	fetch := func() ([]Cluster, error) {
+		defer observeDiscovery(key.Provider, key.Account, key.Region, time.Now())
+
+		return describeEKSClusters(log, config.EKSRegion, config.EKSRoleARN, throttle)
+	}
+
+	if cache == nil {
+		all, err = fetch()
+	} else {
+		all, err = cache.get(key, fetch)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []Cluster
+
+	for _, cluster := range all {
+		if !matchLabels(cluster.Labels, config.EKSTags) {
+			log.V(1).Info("Cluster did not match selector", "cluster", cluster.Name, "account", cluster.AWSAccount, "region", cluster.AWSRegion, "tags", cluster.Labels, "selector", config.EKSTags)
+
+			continue
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+func newEKSCacheKey(region, roleARN string) discoveryCacheKey {
+	key := discoveryCacheKey{
+		Provider: ProviderEKS,
+		Region:   region,
+		RoleARN:  roleARN,
+	}
+
+	if parsed, err := arn.Parse(roleARN); err == nil {
+		key.Account = parsed.AccountID
+	}
+
+	return key
+}
+
+// eksToken returns the token to authenticate against the EKS cluster, like `aws eks get-token` does.
+// The role is assumed when roleARN is not empty.
+func eksToken(clusterName, region, roleARN string) (string, error) {
+	sess := awsclicompat.NewSession(region, "")
+
+	var cfgs []*aws.Config
+
+	if roleARN != "" {
+		cfgs = append(cfgs, &aws.Config{Credentials: stscreds.NewCredentials(sess, roleARN)})
+	}
+
+	stsClient := sts.New(sess, cfgs...)
+
+	req, _ := stsClient.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(eksClusterIDHeader, clusterName)
+
+	presigned, err := req.Presign(eksTokenPresignExpiry)
+	if err != nil {
+		return "", xerrors.Errorf("presigning sts:GetCallerIdentity: %w", err)
+	}
+
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned)), nil
+}
+
+// describeEKSClusters returns all the usable EKS clusters in the region, described using the role when roleARN is not empty.
+// The clusters being created are returned with Creating, so that the ClusterSets selecting them can wait for them.
+func describeEKSClusters(log logr.Logger, region, roleARN string, throttle *awsclicompat.Throttle) ([]Cluster, error) {
+	eksClient := newEKSClient(region, roleARN, throttle)
+
+	log = log.WithValues("region", aws.StringValue(eksClient.Config.Region))
+	if parsed, err := arn.Parse(roleARN); err == nil {
+		log = log.WithValues("account", parsed.AccountID)
+	}
+
+	var clusters []Cluster
+
+	process := func(nextToken *string) (*string, error) {
+		log.V(1).Info("Calling EKS ListClusters")
+
+		result, err := eksClient.ListClusters(&eks.ListClustersInput{
+			NextToken: nextToken,
+		})
+
+		if err != nil {
+			return nil, xerrors.Errorf("listing clusters: %w", err)
+		}
+
+		log.V(1).Info("Found EKS clusters", "count", len(result.Clusters))
+
+		for _, clusterName := range result.Clusters {
+			log.V(1).Info("Describing EKS cluster", "cluster", *clusterName)
+
+			result, err := eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(*clusterName)})
+			if err != nil {
+				return nil, xerrors.Errorf("creating cluster secret: %w", err)
+			}
+
+			status := aws.StringValue(result.Cluster.Status)
+
+			if !usableEKSCluster(status) && status != eks.ClusterStatusCreating {
+				log.Info("Skipping EKS cluster", "cluster", *clusterName, "status", status)
+
+				continue
+			}
+
+			cluster := clusterFromEKS(*clusterName, result)
+			cluster.AWSRoleARN = roleARN
+			cluster.Creating = status == eks.ClusterStatusCreating
+
+			clusters = append(clusters, cluster)
+		}
+
+		return result.NextToken, nil
+	}
+
+	nextToken, err := process(nil)
+	if err != nil {
+		return nil, xerrors.Errorf("processing first set of EKS clusters: %w", err)
+	}
+
+	for nextToken != nil {
+		var err error
+
+		nextToken, err = process(nextToken)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return clusters, nil
+}
+
+// usableEKSCluster returns false for the clusters being created, which have no endpoint yet, and the ones being deleted or failed
+func usableEKSCluster(status string) bool {
+	switch status {
+	case eks.ClusterStatusCreating, eks.ClusterStatusDeleting, eks.ClusterStatusFailed:
+		return false
+	default:
+		return true
+	}
+}
+
+func clusterFromEKS(name string, result *eks.DescribeClusterOutput) Cluster {
+	labels := map[string]string{}
+
+	for k, v := range result.Cluster.Tags {
+		labels[k] = aws.StringValue(v)
+	}
+
+	var caData string
+
+	if ca := result.Cluster.CertificateAuthority; ca != nil {
+		caData = aws.StringValue(ca.Data)
+	}
+
+	cluster := Cluster{
+		Name:            name,
+		Server:          aws.StringValue(result.Cluster.Endpoint),
+		CAData:          caData,
+		AWSClusterName:  name,
+		ARN:             aws.StringValue(result.Cluster.Arn),
+		Version:         aws.StringValue(result.Cluster.Version),
+		PlatformVersion: aws.StringValue(result.Cluster.PlatformVersion),
+		CreatedAt:       result.Cluster.CreatedAt,
+		Labels:          labels,
+	}
+
+	if vpc := result.Cluster.ResourcesVpcConfig; vpc != nil {
+		cluster.EndpointPublicAccess = aws.BoolValue(vpc.EndpointPublicAccess)
+		cluster.EndpointPrivateAccess = aws.BoolValue(vpc.EndpointPrivateAccess)
+		cluster.PublicAccessCIDRs = aws.StringValueSlice(vpc.PublicAccessCidrs)
+	}
+
+	if parsed, err := arn.Parse(cluster.ARN); err == nil {
+		cluster.AWSAccount = parsed.AccountID
+		cluster.AWSRegion = parsed.Region
+	}
+
+	return cluster
+}
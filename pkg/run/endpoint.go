@@ -0,0 +1,163 @@
+package run
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"text/template"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EndpointPolicyRegister registers private-only clusters with their API server endpoints as is
+	EndpointPolicyRegister = "Register"
+	// EndpointPolicySkip doesn't register private-only clusters
+	EndpointPolicySkip = "Skip"
+	// EndpointPolicyProxy registers private-only clusters with the server URLs rendered from the server pattern
+	EndpointPolicyProxy = "Proxy"
+)
+
+// EndpointAccessConfig is the policy for EKS clusters whose API servers aren't reachable from Argo CD over the public endpoints
+type EndpointAccessConfig struct {
+	// PrivateOnly is either of EndpointPolicyRegister, EndpointPolicySkip or EndpointPolicyProxy.
+	// Defaults to EndpointPolicyRegister.
+	PrivateOnly string
+	// ServerPattern is the Go template of the server URLs of the clusters registered with EndpointPolicyProxy
+	ServerPattern string
+	// ServerName overrides the TLS server name of the clusters registered with EndpointPolicyProxy,
+	// which defaults to the hostname of the original server URL
+	ServerName string
+	// PublicAccessCIDR is the CIDR Argo CD connects to the public endpoints from.
+	// Clusters whose public endpoints don't allow it are treated as private-only, too.
+	PublicAccessCIDR string
+}
+
+// serverPatternData is what the server pattern is rendered with
+type serverPatternData struct {
+	Name       string
+	Host       string
+	Server     string
+	AWSAccount string
+	AWSRegion  string
+}
+
+// privateOnly returns true when the API server of the EKS cluster isn't reachable from the CIDR over the public endpoint.
+// Clusters whose endpoint access is unknown, like the ones not on EKS, are never private-only.
+func (c Cluster) privateOnly(fromCIDR string) (bool, error) {
+	if c.EndpointAccess() == "" {
+		return false, nil
+	}
+
+	if !c.EndpointPublicAccess {
+		return true, nil
+	}
+
+	if fromCIDR == "" || len(c.PublicAccessCIDRs) == 0 {
+		return false, nil
+	}
+
+	_, from, err := net.ParseCIDR(fromCIDR)
+	if err != nil {
+		return false, xerrors.Errorf("parsing public access CIDR %q: %w", fromCIDR, err)
+	}
+
+	fromSize, _ := from.Mask.Size()
+
+	for _, cidr := range c.PublicAccessCIDRs {
+		_, allowed, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+
+		// The whole CIDR Argo CD connects from must be within the allowed one
+		if allowedSize, _ := allowed.Mask.Size(); allowed.Contains(from.IP) && allowedSize <= fromSize {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// applyEndpointAccess drops or rewrites the private-only clusters according to the policy
+func applyEndpointAccess(config ClusterSetConfig, clusters []Cluster) ([]Cluster, error) {
+	access := config.EndpointAccess
+
+	if access.PrivateOnly == "" || access.PrivateOnly == EndpointPolicyRegister {
+		return clusters, nil
+	}
+
+	var pattern *template.Template
+
+	if access.PrivateOnly == EndpointPolicyProxy {
+		var err error
+
+		pattern, err = template.New("serverPattern").Option("missingkey=error").Parse(access.ServerPattern)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing server pattern: %w", err)
+		}
+	}
+
+	var result []Cluster
+
+	for _, c := range clusters {
+		private, err := c.privateOnly(access.PublicAccessCIDR)
+		if err != nil {
+			return nil, err
+		}
+
+		if !private {
+			result = append(result, c)
+
+			continue
+		}
+
+		switch access.PrivateOnly {
+		case EndpointPolicySkip:
+			config.log().Info("Skipping private-only cluster", "cluster", c.Name, "account", c.AWSAccount, "region", c.AWSRegion, "server", c.Server)
+
+			continue
+		case EndpointPolicyProxy:
+			if err := proxyCluster(&c, pattern, access.ServerName); err != nil {
+				return nil, xerrors.Errorf("rendering server URL of cluster %s: %w", c.Name, err)
+			}
+
+			config.log().V(1).Info("Registering private-only cluster via proxy", "cluster", c.Name, "account", c.AWSAccount, "region", c.AWSRegion, "server", c.Server, "serverName", c.ServerName)
+		default:
+			return nil, xerrors.Errorf("unsupported endpoint access policy %q: must be either of %s, %s or %s", access.PrivateOnly, EndpointPolicyRegister, EndpointPolicySkip, EndpointPolicyProxy)
+		}
+
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+// proxyCluster rewrites the server URL of the cluster with the pattern, keeping the original hostname as the TLS server name
+func proxyCluster(c *Cluster, pattern *template.Template, serverName string) error {
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return xerrors.Errorf("parsing server URL %q: %w", c.Server, err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := pattern.Execute(&buf, serverPatternData{
+		Name:       c.Name,
+		Host:       u.Hostname(),
+		Server:     c.Server,
+		AWSAccount: c.AWSAccount,
+		AWSRegion:  c.AWSRegion,
+	}); err != nil {
+		return err
+	}
+
+	if serverName == "" {
+		serverName = u.Hostname()
+	}
+
+	c.Server = buf.String()
+	c.ServerName = serverName
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadFixture loads the recorded clusters from the provider fixture files in YAML or JSON.
+// Each file contains either a cluster description or a list of them. A description is either in the JSON shape of
+// eks.DescribeClusterOutput like `aws eks describe-cluster` prints, or the normalized cluster record `record` writes.
+func LoadFixture(paths []string) ([]Cluster, error) {
+	clusters := []Cluster{}
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, xerrors.Errorf("reading provider fixture %s: %w", path, err)
+		}
+
+		loaded, err := parseFixture(data)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing provider fixture %s: %w", path, err)
+		}
+
+		clusters = append(clusters, loaded...)
+	}
+
+	return clusters, nil
+}
+
+func parseFixture(data []byte) ([]Cluster, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []json.RawMessage
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+	} else {
+		items = []json.RawMessage{trimmed}
+	}
+
+	var clusters []Cluster
+
+	for i, item := range items {
+		cluster, ok, err := parseFixtureItem(item)
+		if err != nil {
+			return nil, xerrors.Errorf("item %d: %w", i, err)
+		}
+
+		if ok {
+			clusters = append(clusters, *cluster)
+		}
+	}
+
+	return clusters, nil
+}
+
+// parseFixtureItem returns false for the EKS clusters that the discovery skips for their statuses
+func parseFixtureItem(item json.RawMessage) (*Cluster, bool, error) {
+	var keys map[string]json.RawMessage
+
+	if err := json.Unmarshal(item, &keys); err != nil {
+		return nil, false, err
+	}
+
+	for k := range keys {
+		if !strings.EqualFold(k, "cluster") {
+			continue
+		}
+
+		// Field names of the AWS SDK structs are matched case-insensitively, so that both the output of the AWS CLI
+		// and the SDK structs encoded as JSON are accepted
+		var output eks.DescribeClusterOutput
+
+		if err := json.Unmarshal(item, &output); err != nil {
+			return nil, false, xerrors.Errorf("decoding EKS cluster description: %w", err)
+		}
+
+		if output.Cluster == nil || aws.StringValue(output.Cluster.Name) == "" {
+			return nil, false, xerrors.New("EKS cluster description has no cluster name")
+		}
+
+		if !usableEKSCluster(aws.StringValue(output.Cluster.Status)) {
+			return nil, false, nil
+		}
+
+		cluster := clusterFromEKS(aws.StringValue(output.Cluster.Name), &output)
+		cluster.Provider = ProviderEKS
+
+		return &cluster, true, nil
+	}
+
+	var cluster Cluster
+
+	if err := json.Unmarshal(item, &cluster); err != nil {
+		return nil, false, xerrors.Errorf("decoding cluster record: %w", err)
+	}
+
+	if cluster.Name == "" || cluster.Server == "" {
+		return nil, false, xerrors.New("cluster record must have both name and server")
+	}
+
+	if cluster.Provider == "" {
+		cluster.Provider = ProviderEKS
+	}
+
+	return &cluster, true, nil
+}
+
+// fixtureClusters returns the recorded clusters of the provider of the selector that match it.
+// EKS clusters are matched against the region, the account of the role and the tags, where an empty region matches any.
+func fixtureClusters(fixture []Cluster, sel SelectorConfig) []Cluster {
+	var (
+		matchLabelsOf map[string]string
+		account       string
+	)
+
+	switch sel.provider() {
+	case ProviderHTTP:
+		matchLabelsOf = sel.HTTP.MatchLabels
+	case ProviderOCM:
+		matchLabelsOf = sel.OCM.MatchLabels
+	case ProviderKarmada:
+		matchLabelsOf = sel.Karmada.MatchLabels
+	default:
+		matchLabelsOf = sel.EKSTags
+
+		if parsed, err := arn.Parse(sel.EKSRoleARN); err == nil {
+			account = parsed.AccountID
+		}
+	}
+
+	var clusters []Cluster
+
+	for _, c := range fixture {
+		if c.Provider != sel.provider() || !matchLabels(c.Labels, matchLabelsOf) {
+			continue
+		}
+
+		if sel.provider() == ProviderEKS {
+			if sel.EKSRegion != "" && c.AWSRegion != sel.EKSRegion {
+				continue
+			}
+
+			if account != "" && c.AWSAccount != account {
+				continue
+			}
+
+			c.AWSRoleARN = sel.EKSRoleARN
+		}
+
+		clusters = append(clusters, c)
+	}
+
+	return clusters
+}
+
+// Render returns the cluster secrets desired for the clusters selected by the config, without reading or writing any cluster secret.
+// It needs no access to Kubernetes nor the providers with a provider fixture.
+func Render(config ClusterSetConfig) ([]*corev1.Secret, error) {
+	var clientset kubernetes.Interface
+
+	if config.Fixture == nil {
+		c, err := newClientset(config.log())
+		if err != nil {
+			return nil, xerrors.Errorf("creating clientset: %w", err)
+		}
+
+		clientset = c
+	}
+
+	secrets, _, _, err := clusterSecretsFromClusters(clientset, config)
+
+	return secrets, err
+}
+
+// Record discovers the clusters selected or excluded by the configs from the providers, as the provider fixture to replay them.
+// Bearer tokens are redacted, and the clusters discovered by more than one selector are recorded once.
+func Record(configs []ClusterSetConfig) ([]Cluster, error) {
+	if len(configs) == 0 {
+		return nil, xerrors.New("no ClusterSet to record")
+	}
+
+	var clientset kubernetes.Interface
+
+	recorded := []Cluster{}
+	seen := map[string]struct{}{}
+
+	for _, config := range configs {
+		config.Fixture = nil
+
+		selectors := append([]SelectorConfig{}, config.Selectors...)
+		if len(selectors) == 0 {
+			selectors = []SelectorConfig{{}}
+		}
+
+		if config.Exclude != nil {
+			selectors = append(selectors, *config.Exclude)
+		}
+
+		for i, sel := range selectors {
+			// EKS clusters are recorded without access to Kubernetes, which the other providers need for their secrets
+			if clientset == nil && sel.provider() != ProviderEKS {
+				c, err := newClientset(config.log())
+				if err != nil {
+					return nil, xerrors.Errorf("creating clientset: %w", err)
+				}
+
+				clientset = c
+			}
+
+			clusters, err := discoverClusters(clientset, config, sel)
+			if err != nil {
+				return nil, xerrors.Errorf("selector %d: %w", i, err)
+			}
+
+			for _, c := range clusters {
+				// Clusters being created have no endpoint, and the ones kept have no credentials to be replayed with
+				if c.Creating || c.KeepExisting {
+					continue
+				}
+
+				key := c.Provider + " " + serverKey(c.Server)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+
+				seen[key] = struct{}{}
+
+				c.BearerToken = redactValue(c.BearerToken)
+
+				recorded = append(recorded, c)
+			}
+		}
+	}
+
+	return recorded, nil
+}
@@ -0,0 +1,93 @@
+package run
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata")
+
+func TestRender(t *testing.T) {
+	fixture, err := LoadFixture([]string{filepath.Join("testdata", "fixture.yaml")})
+	if err != nil {
+		t.Fatalf("loading fixture: %v", err)
+	}
+
+	testcases := map[string]ClusterSetConfig{
+		"eks": {
+			NS:   "argocd",
+			Name: "prod",
+			Selectors: []SelectorConfig{
+				{EKSTags: map[string]string{"env": "prod"}, EKSRegion: "us-east-2"},
+			},
+			Labels:       map[string]string{"env": "prod"},
+			NameStrategy: NameStrategyPlain,
+		},
+		"eks-role-prefixed": {
+			NS:   "argocd",
+			Name: "all",
+			Selectors: []SelectorConfig{
+				{EKSRoleARN: "arn:aws:iam::123456789012:role/clusterset"},
+			},
+			NameStrategy: NameStrategyPrefixed,
+			NamePrefix:   "eks-",
+		},
+		"mixed": {
+			NS:   "argocd",
+			Name: "prod",
+			Selectors: []SelectorConfig{
+				{EKSTags: map[string]string{"env": "prod"}},
+				{OCM: &OCMConfig{MatchLabels: map[string]string{"env": "prod"}}},
+			},
+			Exclude:      &SelectorConfig{EKSTags: map[string]string{"env": "staging"}},
+			NameStrategy: NameStrategyPlain,
+		},
+	}
+
+	for name, config := range testcases {
+		t.Run(name, func(t *testing.T) {
+			config.Fixture = fixture
+
+			secrets, err := Render(config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var buf bytes.Buffer
+
+			if err := WriteSecrets(&buf, OutputFormatYAML, secrets); err != nil {
+				t.Fatalf("writing secrets: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "render-"+name+".golden.yaml")
+
+			if *update {
+				if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("updating golden file: %v", err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file: %v", err)
+			}
+
+			if !bytes.Equal(want, buf.Bytes()) {
+				diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+					A:        difflib.SplitLines(string(want)),
+					B:        difflib.SplitLines(buf.String()),
+					FromFile: golden,
+					ToFile:   "rendered",
+					Context:  3,
+				})
+
+				t.Errorf("rendered cluster secrets differ from the golden file. Run `go test ./pkg/run -update` to update it:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package run
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	defaultHTTPItemsPath = "{.items[*]}"
+
+	httpAuthSecretKeyToken   = "token"
+	httpAuthSecretKeyTLSCert = "tls.crt"
+	httpAuthSecretKeyTLSKey  = "tls.key"
+	httpAuthSecretKeyCACert  = "ca.crt"
+)
+
+// HTTPConfig configures the discovery of clusters from a JSON HTTP API
+type HTTPConfig struct {
+	URL string
+	// AuthSecretName is the name of the secret in the ClusterSet's namespace that contains credentials for the URL
+	AuthSecretName string
+	ItemsPath      string
+	NextPath       string
+	Fields         HTTPFields
+	MatchLabels    map[string]string
+}
+
+// HTTPFields contains JSONPath expressions to obtain cluster attributes from each item
+type HTTPFields struct {
+	Name           string
+	Server         string
+	CAData         string
+	AWSClusterName string
+	BearerToken    string
+	Labels         string
+}
+
+func httpClusters(log logr.Logger, clientset kubernetes.Interface, ns string, config HTTPConfig) ([]Cluster, error) {
+	client, crossOriginClient, token, err := newHTTPClient(clientset, ns, config.AuthSecretName)
+	if err != nil {
+		return nil, xerrors.Errorf("creating http client: %w", err)
+	}
+
+	itemsPath := config.ItemsPath
+	if itemsPath == "" {
+		itemsPath = defaultHTTPItemsPath
+	}
+
+	var clusters []Cluster
+
+	visited := map[string]struct{}{}
+
+	for next := config.URL; next != ""; {
+		if _, ok := visited[next]; ok {
+			return nil, xerrors.Errorf("detected pagination loop at %s", next)
+		}
+
+		visited[next] = struct{}{}
+
+		log.V(1).Info("Calling GET", "url", next)
+
+		// Next links can point to other hosts, which must never receive the token or the client certificate for the URL
+		pageClient, pageToken := client, token
+		if !sameOrigin(config.URL, next) {
+			log.V(1).Info("Calling GET without the credentials for the next link to another origin", "url", next)
+
+			pageClient, pageToken = crossOriginClient, ""
+		}
+
+		doc, err := getJSON(pageClient, pageToken, next)
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := findJSONPath(itemsPath, doc)
+		if err != nil {
+			return nil, xerrors.Errorf("evaluating items path: %w", err)
+		}
+
+		log.V(1).Info("Found clusters", "url", next, "count", len(items))
+
+		for _, item := range items {
+			cluster, err := httpCluster(config.Fields, item)
+			if err != nil {
+				return nil, err
+			}
+
+			if !matchLabels(cluster.Labels, config.MatchLabels) {
+				log.V(1).Info("Cluster did not match selector", "cluster", cluster.Name, "labels", cluster.Labels, "selector", config.MatchLabels)
+
+				continue
+			}
+
+			clusters = append(clusters, *cluster)
+		}
+
+		if config.NextPath == "" {
+			break
+		}
+
+		nextLink, err := findJSONPathString(config.NextPath, doc)
+		if err != nil {
+			return nil, xerrors.Errorf("evaluating next path: %w", err)
+		}
+
+		if nextLink == "" {
+			break
+		}
+
+		next, err = resolveURL(next, nextLink)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return clusters, nil
+}
+
+func httpCluster(fields HTTPFields, item interface{}) (*Cluster, error) {
+	var cluster Cluster
+
+	strFields := []struct {
+		name     string
+		path     string
+		value    *string
+		required bool
+	}{
+		{name: "name", path: fields.Name, value: &cluster.Name, required: true},
+		{name: "server", path: fields.Server, value: &cluster.Server, required: true},
+		{name: "caData", path: fields.CAData, value: &cluster.CAData},
+		{name: "awsClusterName", path: fields.AWSClusterName, value: &cluster.AWSClusterName},
+		{name: "bearerToken", path: fields.BearerToken, value: &cluster.BearerToken},
+	}
+
+	for _, f := range strFields {
+		if f.path == "" {
+			if f.required {
+				return nil, xerrors.Errorf("missing JSONPath expression for the required field %q", f.name)
+			}
+
+			continue
+		}
+
+		v, err := findJSONPathString(f.path, item)
+		if err != nil {
+			return nil, xerrors.Errorf("evaluating path for %s: %w", f.name, err)
+		}
+
+		if v == "" && f.required {
+			return nil, xerrors.Errorf("%s resolved to an empty value in %v", f.name, item)
+		}
+
+		*f.value = v
+	}
+
+	if fields.Labels != "" {
+		values, err := findJSONPath(fields.Labels, item)
+		if err != nil {
+			return nil, xerrors.Errorf("evaluating path for labels: %w", err)
+		}
+
+		cluster.Labels = map[string]string{}
+
+		for _, v := range values {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, xerrors.Errorf("labels must be a JSON object, but got %T", v)
+			}
+
+			for k, v := range m {
+				cluster.Labels[k] = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+
+	return &cluster, nil
+}
+
+// newHTTPClient returns the client and the token for the URL, along with the client for next links to other origins,
+// which trusts the same CA but presents no client certificate
+func newHTTPClient(clientset kubernetes.Interface, ns, secretName string) (*http.Client, *http.Client, string, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	if secretName == "" {
+		return client, client, "", nil
+	}
+
+	secret, err := clientset.CoreV1().Secrets(ns).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, "", xerrors.Errorf("getting auth secret %s/%s: %w", ns, secretName, err)
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if ca, ok := secret.Data[httpAuthSecretKeyCACert]; ok {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, nil, "", xerrors.Errorf("no valid certificate found in %s of secret %s", httpAuthSecretKeyCACert, secretName)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	crossOriginClient := &http.Client{
+		Timeout:   client.Timeout,
+		Transport: newHTTPTransport(tlsConfig.Clone()),
+	}
+
+	crt, hasCrt := secret.Data[httpAuthSecretKeyTLSCert]
+	key, hasKey := secret.Data[httpAuthSecretKeyTLSKey]
+
+	if hasCrt && hasKey {
+		cert, err := tls.X509KeyPair(crt, key)
+		if err != nil {
+			return nil, nil, "", xerrors.Errorf("loading client certificate from secret %s: %w", secretName, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if hasCrt || hasKey {
+		return nil, nil, "", xerrors.Errorf("secret %s must contain both %s and %s for mTLS", secretName, httpAuthSecretKeyTLSCert, httpAuthSecretKeyTLSKey)
+	}
+
+	client.Transport = newHTTPTransport(tlsConfig)
+
+	return client, crossOriginClient, string(secret.Data[httpAuthSecretKeyToken]), nil
+}
+
+func newHTTPTransport(tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return transport
+}
+
+func getJSON(client *http.Client, token, u string) (interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("calling GET %s: %w", u, err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("reading response body from %s: %w", u, err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, xerrors.Errorf("unexpected status %d from %s: %s", res.StatusCode, u, string(body))
+	}
+
+	var doc interface{}
+
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, xerrors.Errorf("decoding response from %s: %w", u, err)
+	}
+
+	return doc, nil
+}
+
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", xerrors.Errorf("parsing url %q: %w", base, err)
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", xerrors.Errorf("parsing next link %q: %w", ref, err)
+	}
+
+	return b.ResolveReference(r).String(), nil
+}
+
+// sameOrigin returns true when the URLs have the same scheme, host and port, where an omitted port is the default one of the scheme
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Hostname(), ub.Hostname()) && urlPort(ua) == urlPort(ub)
+}
+
+func urlPort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	default:
+		return ""
+	}
+}
+
+func findJSONPath(expr string, data interface{}) ([]interface{}, error) {
+	jp := jsonpath.New("clusterset")
+	jp.AllowMissingKeys(true)
+
+	if err := jp.Parse(expr); err != nil {
+		return nil, xerrors.Errorf("parsing JSONPath %q: %w", expr, err)
+	}
+
+	results, err := jp.FindResults(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+
+	for _, rs := range results {
+		for _, r := range rs {
+			if r.Kind() == reflect.Interface && r.IsNil() {
+				continue
+			}
+
+			values = append(values, r.Interface())
+		}
+	}
+
+	return values, nil
+}
+
+func findJSONPathString(expr string, data interface{}) (string, error) {
+	values, err := findJSONPath(expr, data)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		if s, ok := values[0].(string); ok {
+			return s, nil
+		}
+
+		return fmt.Sprintf("%v", values[0]), nil
+	default:
+		return "", xerrors.Errorf("JSONPath %q resolved to %d values, but expected at most one", expr, len(values))
+	}
+}
@@ -0,0 +1,152 @@
+package run
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newClientCert returns a self-signed client certificate and key in PEM
+func newClientCert(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "clusterset"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newMTLSServer returns a TLS server that requests client certificates
+func newMTLSServer(handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+
+	return server
+}
+
+func TestHTTPClustersSendsCredentialsOnlyToSameOrigin(t *testing.T) {
+	type credentials struct {
+		auth  string
+		certs int
+	}
+
+	got := map[string]credentials{}
+
+	other := newMTLSServer(func(w http.ResponseWriter, r *http.Request) {
+		got["other"+r.URL.Path] = credentials{auth: r.Header.Get("Authorization"), certs: len(r.TLS.PeerCertificates)}
+
+		fmt.Fprint(w, `{"items":[{"name":"c","server":"https://c"}]}`)
+	})
+	defer other.Close()
+
+	inventory := newMTLSServer(func(w http.ResponseWriter, r *http.Request) {
+		got[r.URL.Path] = credentials{auth: r.Header.Get("Authorization"), certs: len(r.TLS.PeerCertificates)}
+
+		switch r.URL.Path {
+		case "/clusters":
+			fmt.Fprint(w, `{"items":[{"name":"a","server":"https://a"}],"next":"/clusters/2"}`)
+		case "/clusters/2":
+			fmt.Fprintf(w, `{"items":[{"name":"b","server":"https://b"}],"next":"%s/clusters/3"}`, other.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer inventory.Close()
+
+	crt, key := newClientCert(t)
+
+	// Both the servers serve the same certificate of httptest
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: inventory.Certificate().Raw})
+
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "inventory"},
+		Data: map[string][]byte{
+			httpAuthSecretKeyToken:   []byte("token"),
+			httpAuthSecretKeyTLSCert: crt,
+			httpAuthSecretKeyTLSKey:  key,
+			httpAuthSecretKeyCACert:  ca,
+		},
+	})
+
+	clusters, err := httpClusters(logrtesting.NullLogger{}, clientset, "argocd", HTTPConfig{
+		URL:            inventory.URL + "/clusters",
+		AuthSecretName: "inventory",
+		NextPath:       "{.next}",
+		Fields:         HTTPFields{Name: "{.name}", Server: "{.server}"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if names := clusterNames(clusters); len(names) != 3 {
+		t.Errorf("expected clusters from all the pages, got %v", names)
+	}
+
+	want := map[string]credentials{
+		"/clusters":        {auth: "Bearer token", certs: 1},
+		"/clusters/2":      {auth: "Bearer token", certs: 1},
+		"other/clusters/3": {},
+	}
+
+	for page, creds := range want {
+		if c, ok := got[page]; !ok || c != creds {
+			t.Errorf("unexpected credentials for %s: want %+v, got %+v", page, creds, c)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	testcases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "https://cmdb.example.com/clusters", b: "https://cmdb.example.com/clusters?page=2", want: true},
+		{a: "https://cmdb.example.com/clusters", b: "https://CMDB.example.com:443/clusters", want: true},
+		{a: "https://cmdb.example.com/clusters", b: "http://cmdb.example.com/clusters", want: false},
+		{a: "https://cmdb.example.com/clusters", b: "https://cmdb.example.com:8443/clusters", want: false},
+		{a: "https://cmdb.example.com/clusters", b: "https://cmdb.example.com.evil.example/clusters", want: false},
+		{a: "https://cmdb.example.com/clusters", b: "https://other.example.com/clusters", want: false},
+	}
+
+	for _, tc := range testcases {
+		if got := sameOrigin(tc.a, tc.b); got != tc.want {
+			t.Errorf("sameOrigin(%q, %q): want %v, got %v", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
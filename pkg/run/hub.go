@@ -0,0 +1,301 @@
+package run
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	kubeconfigSecretKey = "kubeconfig"
+
+	ocmConditionAvailable = "ManagedClusterConditionAvailable"
+	karmadaConditionReady = "Ready"
+
+	hubSecretKeyToken    = "token"
+	hubSecretKeyCACert   = "ca.crt"
+	hubSecretKeyCABundle = "caBundle"
+)
+
+var (
+	ocmManagedClusterResource = schema.GroupVersionResource{
+		Group:    "cluster.open-cluster-management.io",
+		Version:  "v1",
+		Resource: "managedclusters",
+	}
+
+	karmadaClusterResource = schema.GroupVersionResource{
+		Group:    "cluster.karmada.io",
+		Version:  "v1alpha1",
+		Resource: "clusters",
+	}
+)
+
+// OCMConfig configures the discovery of clusters from Open Cluster Management ManagedClusters
+type OCMConfig struct {
+	MatchLabels map[string]string
+	// ManagedServiceAccount is the name of the token secret in each ManagedCluster's namespace on the hub
+	ManagedServiceAccount string
+	// HubKubeconfigSecretName is the name of the secret in the ClusterSet's namespace containing the kubeconfig for the hub
+	HubKubeconfigSecretName string
+}
+
+// KarmadaConfig configures the discovery of clusters from Karmada Clusters
+type KarmadaConfig struct {
+	MatchLabels map[string]string
+	// HubKubeconfigSecretName is the name of the secret in the ClusterSet's namespace containing the kubeconfig for the Karmada control plane
+	HubKubeconfigSecretName string
+}
+
+func ocmClusters(log logr.Logger, clientset kubernetes.Interface, ns string, config OCMConfig) ([]Cluster, error) {
+	hubDynamic, hubClientset, err := newHubClients(clientset, ns, config.HubKubeconfigSecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ocmManagedClusters(log, hubDynamic, hubClientset, config)
+}
+
+// ocmManagedClusters returns the available ManagedClusters on the hub.
+// A ManagedCluster whose token secret can't be read is returned with KeepExisting, so that it neither fails
+// the discovery of the others nor gets its cluster secret deleted.
+func ocmManagedClusters(log logr.Logger, hubDynamic dynamic.Interface, hubClientset kubernetes.Interface, config OCMConfig) ([]Cluster, error) {
+	log.V(1).Info("Listing OCM ManagedClusters")
+
+	list, err := hubDynamic.Resource(ocmManagedClusterResource).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(config.MatchLabels).String(),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("listing managedclusters: %w", err)
+	}
+
+	log.V(1).Info("Found OCM ManagedClusters", "count", len(list.Items))
+
+	var clusters []Cluster
+
+	for _, item := range list.Items {
+		name := item.GetName()
+
+		if !conditionIsTrue(item, ocmConditionAvailable) {
+			log.Info("Skipping ManagedCluster that is not available", "cluster", name)
+
+			continue
+		}
+
+		configs, _, err := unstructured.NestedSlice(item.Object, "spec", "managedClusterClientConfigs")
+		if err != nil {
+			return nil, xerrors.Errorf("reading client configs of managedcluster %s: %w", name, err)
+		}
+
+		var server, caBundle string
+
+		for _, c := range configs {
+			m, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if url, _, _ := unstructured.NestedString(m, "url"); url != "" {
+				server = url
+				caBundle, _, _ = unstructured.NestedString(m, "caBundle")
+
+				break
+			}
+		}
+
+		if server == "" {
+			log.Info("Skipping ManagedCluster that has no client config", "cluster", name)
+
+			continue
+		}
+
+		secret, err := hubClientset.CoreV1().Secrets(name).Get(context.TODO(), config.ManagedServiceAccount, metav1.GetOptions{})
+		if err == nil && len(secret.Data[hubSecretKeyToken]) == 0 {
+			err = xerrors.Errorf("no %q key", hubSecretKeyToken)
+		}
+
+		if err != nil {
+			log.Error(err, "Keeping ManagedCluster as is, whose token secret can't be read", "cluster", name, "secret", name+"/"+config.ManagedServiceAccount)
+
+			clusters = append(clusters, Cluster{Name: name, Server: server, Labels: item.GetLabels(), KeepExisting: true})
+
+			continue
+		}
+
+		// The token secret contains the CA certificate that Argo CD should trust to connect to the cluster
+		if ca, ok := secret.Data[hubSecretKeyCACert]; ok {
+			caBundle = base64.StdEncoding.EncodeToString(ca)
+		}
+
+		clusters = append(clusters, Cluster{
+			Name:        name,
+			Server:      server,
+			CAData:      caBundle,
+			BearerToken: string(secret.Data[hubSecretKeyToken]),
+			Labels:      item.GetLabels(),
+		})
+	}
+
+	return clusters, nil
+}
+
+func karmadaClusters(log logr.Logger, clientset kubernetes.Interface, ns string, config KarmadaConfig) ([]Cluster, error) {
+	hubDynamic, hubClientset, err := newHubClients(clientset, ns, config.HubKubeconfigSecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	return karmadaReadyClusters(log, hubDynamic, hubClientset, config)
+}
+
+// karmadaReadyClusters returns the ready Clusters on the Karmada control plane.
+// A Cluster whose credentials secret can't be read is returned with KeepExisting, so that it neither fails
+// the discovery of the others nor gets its cluster secret deleted.
+func karmadaReadyClusters(log logr.Logger, hubDynamic dynamic.Interface, hubClientset kubernetes.Interface, config KarmadaConfig) ([]Cluster, error) {
+	log.V(1).Info("Listing Karmada Clusters")
+
+	list, err := hubDynamic.Resource(karmadaClusterResource).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(config.MatchLabels).String(),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("listing karmada clusters: %w", err)
+	}
+
+	log.V(1).Info("Found Karmada Clusters", "count", len(list.Items))
+
+	var clusters []Cluster
+
+	for _, item := range list.Items {
+		name := item.GetName()
+
+		if !conditionIsTrue(item, karmadaConditionReady) {
+			log.Info("Skipping Karmada Cluster that is not ready", "cluster", name)
+
+			continue
+		}
+
+		server, _, _ := unstructured.NestedString(item.Object, "spec", "apiEndpoint")
+		if server == "" {
+			log.Info("Skipping Karmada Cluster that has no API endpoint", "cluster", name)
+
+			continue
+		}
+
+		insecure, _, _ := unstructured.NestedBool(item.Object, "spec", "insecureSkipTLSVerification")
+
+		secretNS, _, _ := unstructured.NestedString(item.Object, "spec", "secretRef", "namespace")
+		secretName, _, _ := unstructured.NestedString(item.Object, "spec", "secretRef", "name")
+
+		if secretName == "" {
+			log.Info("Skipping Karmada Cluster that has no secretRef", "cluster", name)
+
+			continue
+		}
+
+		secret, err := hubClientset.CoreV1().Secrets(secretNS).Get(context.TODO(), secretName, metav1.GetOptions{})
+		if err == nil && len(secret.Data[hubSecretKeyToken]) == 0 {
+			err = xerrors.Errorf("no %q key", hubSecretKeyToken)
+		}
+
+		if err != nil {
+			log.Error(err, "Keeping Karmada Cluster as is, whose credentials secret can't be read", "cluster", name, "secret", secretNS+"/"+secretName)
+
+			clusters = append(clusters, Cluster{Name: name, Server: server, Labels: item.GetLabels(), KeepExisting: true})
+
+			continue
+		}
+
+		var caData string
+
+		if ca, ok := secret.Data[hubSecretKeyCABundle]; ok {
+			caData = base64.StdEncoding.EncodeToString(ca)
+		}
+
+		clusters = append(clusters, Cluster{
+			Name:        name,
+			Server:      server,
+			CAData:      caData,
+			BearerToken: string(secret.Data[hubSecretKeyToken]),
+			Insecure:    insecure,
+			Labels:      item.GetLabels(),
+		})
+	}
+
+	return clusters, nil
+}
+
+func conditionIsTrue(obj unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if t, _, _ := unstructured.NestedString(m, "type"); t != conditionType {
+			continue
+		}
+
+		status, _, _ := unstructured.NestedString(m, "status")
+
+		return status == string(metav1.ConditionTrue)
+	}
+
+	return false
+}
+
+// newHubClients returns clients for the hub cluster the kubeconfig in the secret points to
+func newHubClients(clientset kubernetes.Interface, ns, kubeconfigSecretName string) (dynamic.Interface, kubernetes.Interface, error) {
+	config, err := restConfigFromSecret(clientset, ns, kubeconfigSecretName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("creating dynamic client for hub: %w", err)
+	}
+
+	hubClientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("creating clientset for hub: %w", err)
+	}
+
+	return dynamicClient, hubClientset, nil
+}
+
+// restConfigFromSecret returns the config for the cluster the kubeconfig in the secret points to.
+// It never falls back to the controller's own identity, which would let ClusterSets read secrets in any namespace it can.
+func restConfigFromSecret(clientset kubernetes.Interface, ns, kubeconfigSecretName string) (*rest.Config, error) {
+	if kubeconfigSecretName == "" {
+		return nil, xerrors.Errorf("no kubeconfig secret in namespace %s: hubKubeconfigSecretRef is required", ns)
+	}
+
+	secret, err := clientset.CoreV1().Secrets(ns).Get(context.TODO(), kubeconfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("getting kubeconfig secret %s/%s: %w", ns, kubeconfigSecretName, err)
+	}
+
+	kubeconfig, ok := secret.Data[kubeconfigSecretKey]
+	if !ok {
+		return nil, xerrors.Errorf("kubeconfig secret %s/%s has no %q key", ns, kubeconfigSecretName, kubeconfigSecretKey)
+	}
+
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, xerrors.Errorf("loading kubeconfig from secret %s/%s: %w", ns, kubeconfigSecretName, err)
+	}
+
+	return config, nil
+}
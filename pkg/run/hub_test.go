@@ -0,0 +1,120 @@
+package run
+
+import (
+	"testing"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func hubObject(apiVersion, kind, name string, spec map[string]interface{}, condition string) runtime.Object {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": condition, "status": "True"},
+			},
+		},
+	}}
+}
+
+func tokenSecret(ns, name string) runtime.Object {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Data:       map[string][]byte{hubSecretKeyToken: []byte("token")},
+	}
+}
+
+func clusterNames(clusters []Cluster) []string {
+	var names []string
+
+	for _, c := range clusters {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// assertKept asserts that only the cluster of the name is returned with KeepExisting, without credentials
+func assertKept(t *testing.T, clusters []Cluster, name string) {
+	t.Helper()
+
+	if len(clusters) != 2 {
+		t.Fatalf("expected both the clusters to be returned, got %v", clusterNames(clusters))
+	}
+
+	for _, c := range clusters {
+		if kept := c.Name == name; c.KeepExisting != kept {
+			t.Errorf("unexpected KeepExisting of %s: %v", c.Name, c.KeepExisting)
+		}
+
+		if c.KeepExisting && c.BearerToken != "" {
+			t.Errorf("unexpected token of the kept cluster %s", c.Name)
+		}
+	}
+}
+
+func TestOCMManagedClustersKeepsUnreadableTokenSecret(t *testing.T) {
+	managedCluster := func(name string) runtime.Object {
+		spec := map[string]interface{}{
+			"managedClusterClientConfigs": []interface{}{
+				map[string]interface{}{"url": "https://" + name},
+			},
+		}
+
+		return hubObject("cluster.open-cluster-management.io/v1", "ManagedCluster", name, spec, ocmConditionAvailable)
+	}
+
+	hubDynamic := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), managedCluster("a"), managedCluster("b"))
+	hubClientset := fake.NewSimpleClientset(tokenSecret("a", "argocd"))
+
+	clusters, err := ocmManagedClusters(logrtesting.NullLogger{}, hubDynamic, hubClientset, OCMConfig{ManagedServiceAccount: "argocd"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertKept(t, clusters, "b")
+}
+
+func TestKarmadaReadyClustersKeepsUnreadableCredentialsSecret(t *testing.T) {
+	karmadaCluster := func(name string) runtime.Object {
+		spec := map[string]interface{}{
+			"apiEndpoint": "https://" + name,
+			"secretRef":   map[string]interface{}{"namespace": "karmada-cluster", "name": name},
+		}
+
+		return hubObject("cluster.karmada.io/v1alpha1", "Cluster", name, spec, karmadaConditionReady)
+	}
+
+	hubDynamic := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), karmadaCluster("a"), karmadaCluster("b"))
+	hubClientset := fake.NewSimpleClientset(tokenSecret("karmada-cluster", "b"))
+
+	clusters, err := karmadaReadyClusters(logrtesting.NullLogger{}, hubDynamic, hubClientset, KarmadaConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertKept(t, clusters, "a")
+}
+
+func TestRestConfigFromSecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "no-kubeconfig"},
+	})
+
+	if _, err := restConfigFromSecret(clientset, "argocd", ""); err == nil {
+		t.Errorf("expected an error instead of falling back to the controller's identity")
+	}
+
+	if _, err := restConfigFromSecret(clientset, "argocd", "no-kubeconfig"); err == nil {
+		t.Errorf("expected an error for the secret without kubeconfig")
+	}
+}
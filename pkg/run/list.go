@@ -0,0 +1,171 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ClusterStatusSynced is the status of a cluster whose cluster secret is up to date
+	ClusterStatusSynced = "Synced"
+	// ClusterStatusOutOfSync is the status of a cluster whose cluster secret is going to be created or updated by the next sync
+	ClusterStatusOutOfSync = "OutOfSync"
+	// ClusterStatusPending is the status of a new cluster held back by the rollout policy
+	ClusterStatusPending = "Pending"
+	// ClusterStatusUnreachable is the status of a new cluster held back by the connectivity check
+	ClusterStatusUnreachable = "Unreachable"
+	// ClusterStatusClaimed is the status of a cluster left to another ClusterSet
+	ClusterStatusClaimed = "Claimed"
+
+	SecretStatePresent = "present"
+	SecretStateDrifted = "drifted"
+	SecretStateAbsent  = "absent"
+
+	none = "<none>"
+)
+
+// ClusterInfo is a discovered cluster along with the state of its cluster secret
+type ClusterInfo struct {
+	Name           string `json:"name"`
+	SecretName     string `json:"secretName"`
+	Server         string `json:"server"`
+	AWSAccount     string `json:"awsAccount,omitempty"`
+	AWSRegion      string `json:"awsRegion,omitempty"`
+	Version        string `json:"version,omitempty"`
+	EndpointAccess string `json:"endpointAccess,omitempty"`
+	// Selector describes the selector that selected the cluster
+	Selector string `json:"selector"`
+	// Status is either of ClusterStatusSynced, ClusterStatusOutOfSync, ClusterStatusPending, ClusterStatusUnreachable or ClusterStatusClaimed
+	Status string `json:"status"`
+	// Secret is either of SecretStatePresent, SecretStateDrifted or SecretStateAbsent
+	Secret string `json:"secret"`
+	// Rendered is the desired cluster secret for the cluster in the ClusterSet's namespace
+	Rendered *corev1.Secret `json:"-"`
+}
+
+// ListClusters discovers the clusters selected by the config and compares their cluster secrets against the live ones,
+// without changing anything.
+// With multiple destinations, a cluster is out of sync when its cluster secret is absent or drifted in any of them.
+func ListClusters(config ClusterSetConfig) ([]ClusterInfo, error) {
+	config.DryRun = true
+
+	result, err := Sync(config)
+	if result == nil {
+		return nil, err
+	}
+
+	var refused *PruneRefusedError
+
+	// Deletions are irrelevant to the selected clusters
+	if err != nil && !xerrors.As(err, &refused) {
+		return nil, err
+	}
+
+	created := baseNames(result.Created)
+	updated := baseNames(result.Updated)
+	pending := baseNames(result.PendingCreations)
+	unreachable := baseNames(result.Unreachable)
+	claimed := map[string]struct{}{}
+
+	for _, c := range result.ClaimConflicts {
+		claimed[c.SecretName] = struct{}{}
+	}
+
+	rendered := newClusterSecrets(config, result.SelectedClusters)
+
+	var infos []ClusterInfo
+
+	for i, c := range result.SelectedClusters {
+		info := ClusterInfo{
+			Name:           c.Name,
+			SecretName:     c.SecretName,
+			Server:         c.Server,
+			AWSAccount:     c.AWSAccount,
+			AWSRegion:      c.AWSRegion,
+			Version:        c.Version,
+			EndpointAccess: c.EndpointAccess(),
+			Selector:       c.Selector,
+			Status:         ClusterStatusSynced,
+			Secret:         SecretStatePresent,
+			Rendered:       rendered[i],
+		}
+
+		if _, ok := updated[c.SecretName]; ok {
+			info.Status = ClusterStatusOutOfSync
+			info.Secret = SecretStateDrifted
+		}
+
+		// The cluster secret of a claimed cluster is present, but owned by another ClusterSet
+		for _, s := range []struct {
+			names  map[string]struct{}
+			status string
+			secret string
+		}{
+			{names: created, status: ClusterStatusOutOfSync, secret: SecretStateAbsent},
+			{names: pending, status: ClusterStatusPending, secret: SecretStateAbsent},
+			{names: unreachable, status: ClusterStatusUnreachable, secret: SecretStateAbsent},
+			{names: claimed, status: ClusterStatusClaimed, secret: SecretStatePresent},
+		} {
+			if _, ok := s.names[c.SecretName]; ok {
+				info.Status = s.status
+				info.Secret = s.secret
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// baseNames returns the set of the cluster secret names, with the destinations of qualified ones stripped
+func baseNames(names []string) map[string]struct{} {
+	set := map[string]struct{}{}
+
+	for _, n := range names {
+		set[path.Base(n)] = struct{}{}
+	}
+
+	return set
+}
+
+// WriteClusterTable writes the clusters as a table like kubectl does. wide adds the secret name, server and endpoint access.
+func WriteClusterTable(w io.Writer, clusters []ClusterInfo, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+
+	header := []string{"NAME", "ACCOUNT", "REGION", "VERSION", "STATUS", "SECRET", "SELECTOR"}
+	if wide {
+		header = append(header, "SECRET NAME", "SERVER", "ENDPOINT ACCESS")
+	}
+
+	rows := [][]string{header}
+
+	for _, c := range clusters {
+		row := []string{c.Name, c.AWSAccount, c.AWSRegion, c.Version, c.Status, c.Secret, c.Selector}
+		if wide {
+			row = append(row, c.SecretName, c.Server, c.EndpointAccess)
+		}
+
+		rows = append(rows, row)
+	}
+
+	for _, row := range rows {
+		for i := range row {
+			if row[i] == "" {
+				row[i] = none
+			}
+		}
+
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,81 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Reasons of the events recorded on the ClusterSet for each cluster
+	EventReasonClusterAdded   = "ClusterAdded"
+	EventReasonClusterUpdated = "ClusterUpdated"
+	EventReasonClusterRemoved = "ClusterRemoved"
+	EventReasonClusterFailed  = "ClusterFailed"
+)
+
+// EventSink records Kubernetes events on the ClusterSet being synced
+type EventSink interface {
+	Event(eventType, reason, message string)
+}
+
+// log returns the logger of the ClusterSet, which discards everything when Log is nil
+func (c ClusterSetConfig) log() logr.Logger {
+	if c.Log == nil {
+		return discardLogger{}
+	}
+
+	if c.destination != nil && !c.local() {
+		return c.Log.WithValues("destination", c.destination.String())
+	}
+
+	return c.Log
+}
+
+// event records the event on the ClusterSet unless it's a dry run
+func (c ClusterSetConfig) event(eventType, reason, format string, args ...interface{}) {
+	if c.Events == nil || c.DryRun {
+		return
+	}
+
+	c.Events.Event(eventType, reason, fmt.Sprintf(format, args...))
+}
+
+// clusterSecretKeysAndValues returns the keys and values that identify the cluster of the cluster secret in log lines
+func clusterSecretKeysAndValues(secret *corev1.Secret) []interface{} {
+	name := secret.StringData["name"]
+	if name == "" {
+		name = string(secret.Data["name"])
+	}
+
+	kvs := []interface{}{"secret", secret.Name, "cluster", name}
+
+	if account := secret.Annotations[SecretAnnotationKeyAWSAccount]; account != "" {
+		kvs = append(kvs, "account", account)
+	}
+
+	if region := secret.Annotations[SecretAnnotationKeyAWSRegion]; region != "" {
+		kvs = append(kvs, "region", region)
+	}
+
+	return kvs
+}
+
+func logOrDiscard(log logr.Logger) logr.Logger {
+	if log == nil {
+		return discardLogger{}
+	}
+
+	return log
+}
+
+// discardLogger is a logr.Logger that discards everything, used when no logger is given
+type discardLogger struct{}
+
+func (discardLogger) Enabled() bool                                             { return false }
+func (discardLogger) Info(msg string, keysAndValues ...interface{})             {}
+func (discardLogger) Error(err error, msg string, keysAndValues ...interface{}) {}
+func (l discardLogger) V(level int) logr.Logger                                 { return l }
+func (l discardLogger) WithValues(keysAndValues ...interface{}) logr.Logger     { return l }
+func (l discardLogger) WithName(name string) logr.Logger                        { return l }
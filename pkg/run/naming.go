@@ -0,0 +1,104 @@
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// NameStrategyPlain names the cluster secret after the cluster
+	NameStrategyPlain = "plain"
+	// NameStrategyPrefixed names the cluster secret after the cluster, with the configured prefix
+	NameStrategyPrefixed = "prefixed"
+	// NameStrategyAccountRegionName names the cluster secret `<account>-<region>-<cluster>`
+	NameStrategyAccountRegionName = "account-region-name"
+	// NameStrategyHashed names the cluster secret `<cluster>-<hash>`, where the hash is computed from the ARN or the server URL
+	NameStrategyHashed = "hashed"
+
+	hashLength = 8
+)
+
+var invalidSecretNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// secretName returns the name of the cluster secret for the cluster, which is always a valid DNS-1123 subdomain.
+// Whenever the name needs to be altered to be valid, a hash suffix is added to keep it unique.
+func secretName(strategy, prefix string, cluster Cluster) (string, error) {
+	var name string
+
+	switch strategy {
+	case "", NameStrategyPlain:
+		name = cluster.Name
+	case NameStrategyPrefixed:
+		name = prefix + cluster.Name
+	case NameStrategyAccountRegionName:
+		var parts []string
+
+		for _, p := range []string{cluster.AWSAccount, cluster.AWSRegion, cluster.Name} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+
+		name = strings.Join(parts, "-")
+	case NameStrategyHashed:
+		return sanitizeSecretName(cluster.Name, identityHash(cluster))
+	default:
+		return "", xerrors.Errorf("unsupported name strategy %q", strategy)
+	}
+
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name, nil
+	}
+
+	return sanitizeSecretName(name, identityHash(cluster))
+}
+
+// sanitizeSecretName turns the name into a valid DNS-1123 subdomain with the hash suffix.
+// Each dot-separated label is trimmed of leading and trailing `-`, and empty labels from consecutive dots are dropped.
+func sanitizeSecretName(name, hash string) (string, error) {
+	var labels []string
+
+	for _, l := range strings.Split(invalidSecretNameChars.ReplaceAllString(strings.ToLower(name), "-"), ".") {
+		if l = strings.Trim(l, "-"); l != "" {
+			labels = append(labels, l)
+		}
+	}
+
+	sanitized := strings.Join(labels, ".")
+
+	max := validation.DNS1123SubdomainMaxLength - len(hash) - 1
+	if len(sanitized) > max {
+		sanitized = sanitized[:max]
+	}
+
+	// Truncation can leave a trailing `-` or `.`
+	sanitized = strings.TrimRight(sanitized, ".-")
+
+	if sanitized == "" {
+		sanitized = "cluster"
+	}
+
+	sanitized += "-" + hash
+
+	if errs := validation.IsDNS1123Subdomain(sanitized); len(errs) > 0 {
+		return "", xerrors.Errorf("sanitizing secret name %q: %s", name, strings.Join(errs, ", "))
+	}
+
+	return sanitized, nil
+}
+
+func identityHash(cluster Cluster) string {
+	id := cluster.ARN
+	if id == "" {
+		id = serverKey(cluster.Server)
+	}
+
+	sum := sha256.Sum256([]byte(id))
+
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
@@ -0,0 +1,40 @@
+package run
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestSanitizeSecretName(t *testing.T) {
+	testcases := map[string]struct {
+		name string
+		want string
+	}{
+		"uppercase":              {name: "Prod_Cluster", want: "prod-cluster-abcd1234"},
+		"consecutive dots":       {name: "prod..cluster", want: "prod.cluster-abcd1234"},
+		"dash next to dot":       {name: "prod-.-cluster", want: "prod.cluster-abcd1234"},
+		"leading and trailing":   {name: ".-prod-.", want: "prod-abcd1234"},
+		"only invalid":           {name: "._.", want: "cluster-abcd1234"},
+		"truncated at separator": {name: strings.Repeat("a", 243) + ".-b", want: strings.Repeat("a", 243) + "-abcd1234"},
+		"truncated":              {name: strings.Repeat("a", 300), want: strings.Repeat("a", 244) + "-abcd1234"},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			got, err := sanitizeSecretName(tc.name, "abcd1234")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+
+			if errs := validation.IsDNS1123Subdomain(got); len(errs) > 0 {
+				t.Errorf("invalid secret name %q: %v", got, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OutputFormatTable = "table"
+	OutputFormatWide  = "wide"
+	OutputFormatJSON  = "json"
+	OutputFormatYAML  = "yaml"
+)
+
+// WriteOutput writes v to w in the output format, which is either of table, wide, json or yaml.
+// table is called to write the human-readable output in the table and wide formats.
+func WriteOutput(w io.Writer, format string, v interface{}, table func(w io.Writer, wide bool) error) error {
+	switch format {
+	case OutputFormatTable, "":
+		return table(w, false)
+	case OutputFormatWide:
+		return table(w, true)
+	case OutputFormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("rendering json: %w", err)
+		}
+
+		_, err = w.Write(append(data, '\n'))
+
+		return err
+	case OutputFormatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return xerrors.Errorf("rendering yaml: %w", err)
+		}
+
+		_, err = w.Write(data)
+
+		return err
+	default:
+		return xerrors.Errorf("unsupported output format %q: it must be either of %s, %s, %s or %s", format, OutputFormatTable, OutputFormatWide, OutputFormatJSON, OutputFormatYAML)
+	}
+}
+
+// WriteSecrets writes the cluster secrets to w in the output format. They are written as a List in json and yaml,
+// and as a table of the names and the servers otherwise.
+func WriteSecrets(w io.Writer, format string, secrets []*corev1.Secret) error {
+	items := []*corev1.Secret{}
+	items = append(items, secrets...)
+
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	}
+
+	return WriteOutput(w, format, list, func(w io.Writer, wide bool) error {
+		tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+
+		header := "NAME\tSERVER"
+		if wide {
+			header += "\tNAMESPACE\tCLUSTER"
+		}
+
+		if _, err := fmt.Fprintln(tw, header); err != nil {
+			return err
+		}
+
+		for _, s := range items {
+			row := s.Name + "\t" + s.StringData["server"]
+			if wide {
+				row += "\t" + s.Namespace + "\t" + s.StringData["name"]
+			}
+
+			if _, err := fmt.Fprintln(tw, row); err != nil {
+				return err
+			}
+		}
+
+		return tw.Flush()
+	})
+}
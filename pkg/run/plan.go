@@ -0,0 +1,278 @@
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ChangeActionCreate = "create"
+	ChangeActionUpdate = "update"
+	ChangeActionDelete = "delete"
+
+	redacted = "<redacted>"
+)
+
+// Change is a cluster secret created, updated or deleted by a sync
+type Change struct {
+	Action string
+	// Name is the name of the cluster secret, qualified with the destination when not in the ClusterSet's namespace
+	Name string
+	// Before is the cluster secret before the change, which is nil on creation
+	Before *corev1.Secret
+	// After is the cluster secret after the change, which is nil on deletion
+	After *corev1.Secret
+}
+
+// Plan is the changes a sync would make to the cluster secrets
+type Plan struct {
+	Changes []PlannedChange `json:"changes"`
+	// PendingCreations and PendingDeletions are the cluster secrets the rollout and prune policies hold back
+	PendingCreations []string `json:"pendingCreations,omitempty"`
+	PendingDeletions []string `json:"pendingDeletions,omitempty"`
+}
+
+// PlannedChange is a change to a cluster secret with the unified diff of the secret, whose sensitive values are redacted
+type PlannedChange struct {
+	Action string `json:"action"`
+	Secret string `json:"secret"`
+	Server string `json:"server,omitempty"`
+	Diff   string `json:"diff"`
+}
+
+// HasChanges returns true when the sync would create, update or delete any cluster secret
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// WriteText writes the human-readable summary and diffs of the plan, which is the same with or without wide
+func (p *Plan) WriteText(w io.Writer, wide bool) error {
+	for _, c := range p.Changes {
+		if _, err := fmt.Fprintf(w, "# %s %s\n%s\n", c.Action, c.Secret, c.Diff); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range p.PendingCreations {
+		if _, err := fmt.Fprintf(w, "# pending creation %s\n", name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range p.PendingDeletions {
+		if _, err := fmt.Fprintf(w, "# pending deletion %s\n", name); err != nil {
+			return err
+		}
+	}
+
+	var creates, updates, deletes int
+
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ChangeActionCreate:
+			creates++
+		case ChangeActionUpdate:
+			updates++
+		case ChangeActionDelete:
+			deletes++
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete.\n", creates, updates, deletes)
+
+	return err
+}
+
+// NewPlan computes the changes a sync would make without making any, diffing the desired cluster secrets against the live ones.
+// The plan is returned along with the error when the prune policy refuses deletions, so that the rest can still be reviewed.
+func NewPlan(config ClusterSetConfig) (*Plan, error) {
+	config.DryRun = true
+
+	result, err := Sync(config)
+	if result == nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Changes:          []PlannedChange{},
+		PendingCreations: result.PendingCreations,
+	}
+
+	for _, d := range result.PendingDeletions {
+		plan.PendingDeletions = append(plan.PendingDeletions, d.Name)
+	}
+
+	for _, c := range result.Changes {
+		planned, diffErr := planChange(c)
+		if diffErr != nil {
+			return nil, diffErr
+		}
+
+		plan.Changes = append(plan.Changes, *planned)
+	}
+
+	return plan, err
+}
+
+func planChange(c Change) (*PlannedChange, error) {
+	before, err := secretDocument(c.Before)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := secretDocument(c.After)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: "live/" + c.Name,
+		ToFile:   "desired/" + c.Name,
+		Context:  3,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("diffing cluster secret %q: %w", c.Name, err)
+	}
+
+	planned := &PlannedChange{
+		Action: c.Action,
+		Secret: c.Name,
+		Diff:   diff,
+	}
+
+	for _, s := range []*corev1.Secret{c.After, c.Before} {
+		if data := secretData(s); data["server"] != "" {
+			planned.Server = data["server"]
+
+			break
+		}
+	}
+
+	return planned, nil
+}
+
+// secretDocument renders the labels, annotations and data of the secret as YAML with the sensitive values redacted.
+// It's empty for a nil secret.
+func secretDocument(secret *corev1.Secret) (string, error) {
+	if secret == nil {
+		return "", nil
+	}
+
+	data := secretData(secret)
+
+	for k, v := range data {
+		switch k {
+		case "name", "server":
+		case "config":
+			data[k] = redactClusterConfig(v)
+		default:
+			data[k] = redactValue(v)
+		}
+	}
+
+	doc := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      secret.Labels,
+			"annotations": secret.Annotations,
+		},
+		"data": data,
+	}
+
+	text, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", xerrors.Errorf("rendering cluster secret %q: %w", secret.Name, err)
+	}
+
+	return string(text), nil
+}
+
+// secretData returns the data of the secret decoded, which is either in StringData for desired secrets or Data for live ones
+func secretData(secret *corev1.Secret) map[string]string {
+	data := map[string]string{}
+
+	if secret == nil {
+		return data
+	}
+
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+
+	for k, v := range secret.StringData {
+		data[k] = v
+	}
+
+	return data
+}
+
+// sensitiveClusterConfigKeys are the keys in the `config` of cluster secrets whose values are redacted
+var sensitiveClusterConfigKeys = map[string]struct{}{
+	"bearerToken": {},
+	"password":    {},
+	"keyData":     {},
+}
+
+// redactClusterConfig redacts the credentials in the `config` of the cluster secret, while keeping it a readable JSON
+func redactClusterConfig(config string) string {
+	var v interface{}
+
+	if err := json.Unmarshal([]byte(config), &v); err != nil {
+		return redactValue(config)
+	}
+
+	v = redactJSON(v)
+
+	text, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return redactValue(config)
+	}
+
+	return string(text) + "\n"
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k := range t {
+			if s, ok := t[k].(string); ok {
+				if _, sensitive := sensitiveClusterConfigKeys[k]; sensitive {
+					t[k] = redactValue(s)
+
+					continue
+				}
+			}
+
+			t[k] = redactJSON(t[k])
+		}
+
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = redactJSON(t[i])
+		}
+
+		return t
+	default:
+		return v
+	}
+}
+
+// redactValue replaces the value with a short hash of it, so that changes to the value still show up in diffs
+func redactValue(v string) string {
+	if v == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(v))
+
+	return fmt.Sprintf("%s sha256:%x", redacted, sum[:4])
+}
@@ -0,0 +1,86 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// PruneConfig guards cluster secrets against deletions caused by transient discovery failures
+type PruneConfig struct {
+	// Disabled keeps cluster secrets of clusters that are no longer selected, instead of deleting them
+	Disabled bool
+	// GracePeriod is how long a cluster must be missing for before its cluster secret is deleted
+	GracePeriod time.Duration
+	// MaxDeletions is the maximum number or percentage of the managed cluster secrets deleted in a sync. Unlimited when nil.
+	MaxDeletions *intstr.IntOrString
+}
+
+// PendingDeletion is a cluster secret whose cluster is no longer selected, but kept by the prune policy
+type PendingDeletion struct {
+	Name         string
+	MissingSince time.Time
+}
+
+// PruneRefusedError is returned when a sync would delete more cluster secrets than PruneConfig.MaxDeletions allows.
+// No cluster secret is deleted in that case.
+type PruneRefusedError struct {
+	// Deletions is the names of the cluster secrets that would have been deleted
+	Deletions []string
+	// Max is the maximum number of deletions computed from PruneConfig.MaxDeletions
+	Max int
+	// Total is the number of the cluster secrets managed by the ClusterSet
+	Total int
+}
+
+func (e *PruneRefusedError) Error() string {
+	return fmt.Sprintf("refused to delete %d out of %d cluster secrets, which exceeds the maximum of %d deletions per sync", len(e.Deletions), e.Total, e.Max)
+}
+
+// maxDeletions returns the maximum number of the deletions out of the total number of managed cluster secrets,
+// or -1 when unlimited
+func (c PruneConfig) maxDeletions(total int) (int, error) {
+	if c.MaxDeletions == nil {
+		return -1, nil
+	}
+
+	max, err := intstr.GetValueFromIntOrPercent(c.MaxDeletions, total, false)
+	if err != nil {
+		return 0, xerrors.Errorf("invalid maxDeletions %q: %w", c.MaxDeletions.String(), err)
+	}
+
+	return max, nil
+}
+
+// markMissing records when the cluster of the cluster secret was first found missing, and returns it.
+// The annotation is removed by updateExisting once the cluster is selected again, as it isn't on the desired secret.
+func markMissing(kubeclient typedcorev1.SecretInterface, secret corev1.Secret, now time.Time, dryRun bool) (time.Time, error) {
+	if v, ok := secret.Annotations[SecretAnnotationKeyMissingSince]; ok {
+		if since, err := time.Parse(time.RFC3339, v); err == nil {
+			return since, nil
+		}
+	}
+
+	if dryRun {
+		return now, nil
+	}
+
+	updated := secret.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+
+	updated.Annotations[SecretAnnotationKeyMissingSince] = now.UTC().Format(time.RFC3339)
+
+	if _, err := kubeclient.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		return time.Time{}, xerrors.Errorf("marking cluster secret %q missing: %w", secret.Name, err)
+	}
+
+	return now, nil
+}
@@ -0,0 +1,56 @@
+package run
+
+import (
+	"time"
+)
+
+// RolloutConfig limits how fast cluster secrets are created for newly selected clusters
+type RolloutConfig struct {
+	// MaxNewClusters is the maximum number of cluster secrets created per Interval. Unlimited when zero.
+	MaxNewClusters int
+	// Interval is the minimum interval between waves of new clusters. Every sync is a wave when zero.
+	Interval time.Duration
+	// LastWave is when the last wave of new clusters was created
+	LastWave time.Time
+	// RequireApproval holds back new clusters whose cluster secret names aren't in Approved
+	RequireApproval bool
+	// Approved is the names of the cluster secrets approved to be created. `*` approves all.
+	Approved []string
+}
+
+// NextWave returns when the next wave of new clusters can be created
+func (c RolloutConfig) NextWave() time.Time {
+	if c.MaxNewClusters <= 0 || c.LastWave.IsZero() {
+		return time.Time{}
+	}
+
+	return c.LastWave.Add(c.Interval)
+}
+
+// admits returns true when the cluster secret of the new cluster can be created now,
+// given the number of cluster secrets already created in this wave.
+func (c RolloutConfig) admits(name string, created int, now time.Time) bool {
+	if c.RequireApproval && !c.approved(name) {
+		return false
+	}
+
+	if c.MaxNewClusters <= 0 {
+		return true
+	}
+
+	if now.Before(c.NextWave()) {
+		return false
+	}
+
+	return created < c.MaxNewClusters
+}
+
+func (c RolloutConfig) approved(name string) bool {
+	for _, a := range c.Approved {
+		if a == "*" || a == name {
+			return true
+		}
+	}
+
+	return false
+}
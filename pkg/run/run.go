@@ -5,20 +5,25 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/go-logr/logr"
 	"github.com/mumoshu/argocd-clusterset/pkg/awsclicompat"
+	"github.com/mumoshu/argocd-clusterset/pkg/metrics"
 	"golang.org/x/xerrors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
-	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"sigs.k8s.io/yaml"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -28,13 +33,204 @@ type Config struct {
 	Endpoint string
 	CAData   string
 	Labels   map[string]string
+	// Log discards everything when nil
+	Log logr.Logger
 }
 
 type ClusterSetConfig struct {
-	DryRun  bool
-	NS      string
-	EKSTags map[string]string
+	DryRun bool
+	NS     string
+	// Name is the name of the ClusterSet recorded on the cluster secrets. Can be empty when run from the command-line.
+	Name string
+	// Selectors are the sources of clusters. The union of the clusters selected by them are synced.
+	// All the EKS clusters are synced when empty.
+	Selectors []SelectorConfig
+	// Exclude selects clusters that are never synced even when selected by Selectors
+	Exclude *SelectorConfig
 	Labels  map[string]string
+	// NameStrategy is either of NameStrategyPlain, NameStrategyPrefixed, NameStrategyAccountRegionName or NameStrategyHashed.
+	// Defaults to NameStrategyPlain.
+	NameStrategy string
+	// NamePrefix is prepended to the cluster secret names when NameStrategy is NameStrategyPrefixed
+	NamePrefix string
+	// EndpointAccess is the policy for EKS clusters with private-only API server endpoints. They are registered as is by default.
+	EndpointAccess EndpointAccessConfig
+	// Cache is shared across ClusterSets to reduce provider API calls. Clusters are discovered on every sync when nil.
+	Cache *DiscoveryCache
+	// Throttle retries and rate-limits AWS API calls. The AWS SDK defaults are used when nil.
+	Throttle *awsclicompat.Throttle
+	// Prune guards cluster secrets against deletions. Cluster secrets are deleted as soon as their clusters go missing by default.
+	Prune PruneConfig
+	// Rollout limits how fast cluster secrets are created for new clusters. All of them are created at once by default.
+	Rollout RolloutConfig
+	// Priority resolves conflicts with other ClusterSets claiming the same clusters. The higher wins, and the current owner wins a tie.
+	Priority int32
+	// ClusterSets is the priorities of all the ClusterSets by `NAMESPACE/NAME`.
+	// Conflicts with other ClusterSets aren't detected when nil.
+	ClusterSets map[string]int32
+	// TargetNamespaces are the namespaces of the Argo CD instances the cluster secrets are written into.
+	// Secrets referenced by the selectors are always read from NS.
+	TargetNamespaces []string
+	// Destinations are the Argo CD instances the cluster secrets are written into, in addition to TargetNamespaces.
+	// The cluster secrets are written into NS when both are empty.
+	Destinations []DestinationConfig
+
+	// Fixture is the recorded clusters the selectors select from in place of the providers, which needs no access to them.
+	// Clusters are discovered from the providers when nil. Cluster secrets are never written with a fixture.
+	Fixture []Cluster
+
+	// Connectivity verifies the selected clusters are reachable before registering them. Disabled by default.
+	Connectivity ConnectivityConfig
+	// Log is the logger for the ClusterSet. Everything is discarded when nil.
+	Log logr.Logger
+	// Events records events on the ClusterSet for each cluster added, updated, removed or failed. No event is recorded when nil.
+	Events EventSink
+
+	// destination is the destination being synced
+	destination *DestinationConfig
+	// unreachableClusters is the errors of the connectivity checks of the unreachable clusters by the cluster secret names
+	unreachableClusters map[string]error
+	// keptServers is the servers of the selected clusters whose existing cluster secrets are kept, by serverKey
+	keptServers map[string]struct{}
+}
+
+// namespace returns the namespace the cluster secrets are written into
+func (c ClusterSetConfig) namespace() string {
+	if c.destination != nil {
+		return c.destination.Namespace
+	}
+
+	return c.NS
+}
+
+// local returns true when the cluster secrets are written into the ClusterSet's own namespace
+func (c ClusterSetConfig) local() bool {
+	return c.namespace() == c.NS && (c.destination == nil || c.destination.KubeconfigSecretName == "")
+}
+
+// owner returns the value of the clusterset annotation on the cluster secrets,
+// which is qualified with the ClusterSet's namespace when written into another namespace
+func (c ClusterSetConfig) owner() string {
+	if c.local() {
+		return c.Name
+	}
+
+	return c.NS + "/" + c.Name
+}
+
+// qualify returns the name of the cluster secret qualified with the destination when written into another namespace
+func (c ClusterSetConfig) qualify(name string) string {
+	if c.local() {
+		return name
+	}
+
+	return c.destination.String() + "/" + name
+}
+
+// observeSecret counts the cluster secret operation with the result
+func (c ClusterSetConfig) observeSecret(result string) {
+	metrics.ClusterSecretOperations.WithLabelValues(c.NS, c.Name, result).Inc()
+}
+
+// SelectorConfig selects clusters from exactly one source.
+// EKS is used unless either of HTTP, OCM or Karmada is set.
+type SelectorConfig struct {
+	EKSTags    map[string]string
+	EKSRegion  string
+	EKSRoleARN string
+	// HTTP discovers clusters from a JSON HTTP API instead of EKS when set
+	HTTP *HTTPConfig
+	// OCM discovers clusters from Open Cluster Management ManagedClusters instead of EKS when set
+	OCM *OCMConfig
+	// Karmada discovers clusters from Karmada Clusters instead of EKS when set
+	Karmada *KarmadaConfig
+}
+
+// provider returns the provider the selector discovers clusters from
+func (s SelectorConfig) provider() string {
+	switch {
+	case s.HTTP != nil:
+		return ProviderHTTP
+	case s.OCM != nil:
+		return ProviderOCM
+	case s.Karmada != nil:
+		return ProviderKarmada
+	default:
+		return ProviderEKS
+	}
+}
+
+// String describes the source and the criteria of the selector, like `eks region=us-east-2 env=prod`
+func (s SelectorConfig) String() string {
+	var parts []string
+
+	parts = append(parts, s.provider())
+
+	switch s.provider() {
+	case ProviderHTTP:
+		parts = append(parts, s.HTTP.URL, labels.SelectorFromSet(s.HTTP.MatchLabels).String())
+	case ProviderOCM:
+		parts = append(parts, labels.SelectorFromSet(s.OCM.MatchLabels).String())
+	case ProviderKarmada:
+		parts = append(parts, labels.SelectorFromSet(s.Karmada.MatchLabels).String())
+	default:
+		if s.EKSRegion != "" {
+			parts = append(parts, "region="+s.EKSRegion)
+		}
+
+		if s.EKSRoleARN != "" {
+			parts = append(parts, "roleARN="+s.EKSRoleARN)
+		}
+
+		parts = append(parts, labels.SelectorFromSet(s.EKSTags).String())
+	}
+
+	var nonEmpty []string
+
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+
+	return strings.Join(nonEmpty, " ")
+}
+
+// Result is the outcome of a sync
+type Result struct {
+	// Clusters is the names of the clusters selected by the ClusterSet
+	Clusters []string
+	// SelectedClusters is the clusters selected by the ClusterSet, in the same order as Clusters
+	SelectedClusters []Cluster
+	// Conflicts lists clusters that two or more selectors disagreed on
+	Conflicts []Conflict
+	// Created, Updated and Deleted are the names of the cluster secrets created, updated and deleted,
+	// or would have been with DryRun
+	Created []string
+	Updated []string
+	Deleted []string
+	// NewClusters is the names of the cluster secrets in Created for clusters that weren't registered under any name,
+	// which are the ones counted against the rollout policy
+	NewClusters []string
+	// Changes is the cluster secrets created, updated and deleted, or would have been with DryRun, in the order they were made
+	Changes []Change
+	// PendingDeletions is the cluster secrets of the missing clusters kept by the prune policy
+	PendingDeletions []PendingDeletion
+	// PendingCreations is the names of the cluster secrets of the new clusters held back by the rollout policy
+	PendingCreations []string
+	// ClaimConflicts lists clusters left to other ClusterSets that claimed them first or with higher priorities
+	ClaimConflicts []ClaimConflict
+	// Destinations is the outcome for each destination
+	Destinations []DestinationResult
+	// Connectivity is the outcome of the connectivity check of each selected cluster, when enabled
+	Connectivity []ConnectivityResult
+	// Unreachable is the names of the cluster secrets of the unreachable clusters held back by the connectivity check
+	Unreachable []string
+	// CreatingClusters is the names of the selected EKS clusters being created, which are registered once they become active
+	CreatingClusters []string
+
+	// newServers is the servers of NewClusters by serverKey, so that a new cluster is counted once across destinations
+	newServers map[string]struct{}
 }
 
 func Create(config Config) error {
@@ -44,8 +240,9 @@ func Create(config Config) error {
 	caData := config.CAData
 	dryRun := config.DryRun
 	labels := config.Labels
+	log := logOrDiscard(config.Log)
 
-	clientset, err := newClientset()
+	clientset, err := newClientset(log)
 	if err != nil {
 		return xerrors.Errorf("creating clientset: %w", err)
 	}
@@ -63,7 +260,12 @@ func Create(config Config) error {
 			panic(err)
 		}
 	} else {
-		object = newClusterSecretFromValues(ns, name, labels, endpoint, caData)
+		object = newClusterSecretFromValues(ns, labels, Cluster{
+			Name:           name,
+			Server:         endpoint,
+			CAData:         caData,
+			AWSClusterName: name,
+		})
 	}
 
 	if dryRun {
@@ -83,43 +285,133 @@ func Create(config Config) error {
 		return err
 	}
 
-	fmt.Printf("Cluster secert %q created successfully\n", name)
+	log.Info("Created cluster secret", "secret", name)
 
 	return nil
 }
 
 func CreateMissing(config ClusterSetConfig) error {
-	ns := config.NS
-	dryRun := config.DryRun
-
-	clientset, err := newClientset()
+	clientset, err := newClientset(config.log())
 	if err != nil {
 		return xerrors.Errorf("creating clientset: %w", err)
 	}
 
-	kubeclient := clientset.CoreV1().Secrets(ns)
+	objects, _, _, err := clusterSecretsFromClusters(clientset, config)
+	if err != nil {
+		return err
+	}
+
+	return createMissing(clientset, config, objects, &Result{})
+}
+
+func createMissing(clientset kubernetes.Interface, config ClusterSetConfig, objects []*corev1.Secret, result *Result) error {
+	// Cluster secrets rendered from a provider fixture have redacted bearer tokens, and the fixture may miss registered clusters
+	if config.Fixture != nil {
+		config.DryRun = true
+	}
+
+	kubeclient := clientset.CoreV1().Secrets(config.namespace())
+	log := config.log()
+
+	// Clusters registered under other names, like the ones being renamed, aren't new and never held back by the rollout policy
+	registeredServers := map[string]struct{}{}
 
-	objects, err := clusterSecretsFromClusters(ns, config.EKSTags, config.Labels)
+	current, err := listClusterSecrets(kubeclient, config.Labels)
 	if err != nil {
 		return err
 	}
 
+	for _, item := range current.Items {
+		registeredServers[serverKey(string(item.Data["server"]))] = struct{}{}
+	}
+
+	if result.newServers == nil {
+		result.newServers = map[string]struct{}{}
+	}
+
+	now := time.Now()
+
 	for _, object := range objects {
+		log := log.WithValues(clusterSecretKeysAndValues(object)...)
+
+		current, err := kubeclient.Get(context.TODO(), object.Name, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return xerrors.Errorf("getting cluster secret %q: %w", object.Name, err)
+		}
+
+		if err == nil {
+			merged, updated, err := updateExisting(kubeclient, current, object, config.DryRun)
+			if err != nil {
+				config.observeSecret(metrics.ResultFailed)
+				config.event(corev1.EventTypeWarning, EventReasonClusterFailed, "Failed to update cluster secret %q for cluster %s: %v", object.Name, object.StringData["server"], err)
+
+				return err
+			}
+
+			if !updated {
+				log.V(1).Info("Cluster secret has no change")
+
+				continue
+			}
+
+			result.Updated = append(result.Updated, config.qualify(object.Name))
+			result.Changes = append(result.Changes, Change{Action: ChangeActionUpdate, Name: config.qualify(object.Name), Before: current, After: merged})
+
+			if !config.DryRun {
+				config.observeSecret(metrics.ResultUpdated)
+				config.event(corev1.EventTypeNormal, EventReasonClusterUpdated, "Updated cluster secret %q for cluster %s", config.qualify(object.Name), object.StringData["server"])
+			}
+
+			log.Info("Updated cluster secret", "dryRun", config.DryRun)
+
+			continue
+		}
+
+		if err := config.unreachable(object); err != nil {
+			log.Info("Holding back cluster secret of unreachable cluster", "reason", err.Error())
+
+			result.Unreachable = append(result.Unreachable, config.qualify(object.Name))
+
+			continue
+		}
+
+		server := serverKey(object.StringData["server"])
+
+		_, registered := registeredServers[server]
+		// A new cluster admitted for another destination in this sync is admitted again without counting it twice
+		_, admitted := result.newServers[server]
+
+		if !registered && !admitted && !config.Rollout.admits(object.Name, len(result.newServers), now) {
+			log.Info("Cluster secret is pending rollout")
+
+			result.PendingCreations = append(result.PendingCreations, config.qualify(object.Name))
+
+			continue
+		}
+
+		if !registered {
+			result.newServers[server] = struct{}{}
+			result.NewClusters = append(result.NewClusters, config.qualify(object.Name))
+		}
+
+		result.Created = append(result.Created, config.qualify(object.Name))
+		result.Changes = append(result.Changes, Change{Action: ChangeActionCreate, Name: config.qualify(object.Name), After: object})
+
 		// Manage resource
-		if !dryRun {
+		if !config.DryRun {
 			_, err := kubeclient.Create(context.TODO(), object, metav1.CreateOptions{})
 			if err != nil {
-				if errors.IsAlreadyExists(err) {
-					fmt.Printf("Cluster secert %q has no change\n", object.Name)
-				} else {
-					return err
-				}
-			} else {
-				fmt.Printf("Cluster secert %q created successfully\n", object.Name)
+				config.observeSecret(metrics.ResultFailed)
+				config.event(corev1.EventTypeWarning, EventReasonClusterFailed, "Failed to create cluster secret %q for cluster %s: %v", object.Name, object.StringData["server"], err)
+
+				return err
 			}
-		} else {
-			fmt.Printf("Cluster secert %q created successfully (Dry Run)\n", object.Name)
+
+			config.observeSecret(metrics.ResultCreated)
+			config.event(corev1.EventTypeNormal, EventReasonClusterAdded, "Created cluster secret %q for cluster %s", config.qualify(object.Name), object.StringData["server"])
 		}
+
+		log.Info("Created cluster secret", "dryRun", config.DryRun)
 	}
 
 	return nil
@@ -129,8 +421,9 @@ func Delete(config Config) error {
 	ns := config.NS
 	name := config.Name
 	dryRun := config.DryRun
+	log := logOrDiscard(config.Log)
 
-	clientset, err := newClientset()
+	clientset, err := newClientset(log)
 	if err != nil {
 		return xerrors.Errorf("creating clientset: %w", err)
 	}
@@ -138,7 +431,7 @@ func Delete(config Config) error {
 	kubeclient := clientset.CoreV1().Secrets(ns)
 
 	if dryRun {
-		fmt.Fprintf(os.Stdout, "Cluster secrer %q deleted successfully (dry run)\n", name)
+		log.Info("Deleted cluster secret", "secret", name, "dryRun", true)
 
 		return nil
 	}
@@ -149,146 +442,361 @@ func Delete(config Config) error {
 		return err
 	}
 
-	fmt.Printf("Cluster secert %q deleted successfully\n", name)
+	log.Info("Deleted cluster secret", "secret", name)
 
 	return nil
 }
 
 func DeleteMissing(config ClusterSetConfig) error {
-	ns := config.NS
-	dryRun := config.DryRun
-
-	clientset, err := newClientset()
+	clientset, err := newClientset(config.log())
 	if err != nil {
 		return xerrors.Errorf("creating clientset: %w", err)
 	}
 
-	kubeclient := clientset.CoreV1().Secrets(ns)
-
-	labelSelectors := []string{
-		fmt.Sprintf("%s=%s", SecretLabelKeyArgoCDType, SecretLabelValueArgoCDCluster),
+	objects, _, kept, err := clusterSecretsFromClusters(clientset, config)
+	if err != nil {
+		return err
 	}
 
-	for k, v := range config.Labels {
-		labelSelectors = append(labelSelectors, fmt.Sprintf("%s=%s", k, v))
-	}
+	config.keptServers = kept
 
-	result, err := kubeclient.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: strings.Join(labelSelectors, ","),
-	})
-	if err != nil {
-		return xerrors.Errorf("listing cluster secrets: %w", err)
+	return deleteMissing(clientset, config, objects, &Result{})
+}
+
+func deleteMissing(clientset kubernetes.Interface, config ClusterSetConfig, objects []*corev1.Secret, result *Result) error {
+	// Cluster secrets rendered from a provider fixture have redacted bearer tokens, and the fixture may miss registered clusters
+	if config.Fixture != nil {
+		config.DryRun = true
 	}
 
-	objects, err := clusterSecretsFromClusters(ns, config.EKSTags, config.Labels)
+	kubeclient := clientset.CoreV1().Secrets(config.namespace())
+	log := config.log()
+
+	current, err := listClusterSecrets(kubeclient, config.Labels)
 	if err != nil {
 		return err
 	}
 
 	desiredClusters := map[string]struct{}{}
+	desiredServers := map[string]string{}
 
 	for _, obj := range objects {
 		desiredClusters[obj.Name] = struct{}{}
+		desiredServers[serverKey(obj.StringData["server"])] = obj.Name
+	}
+
+	// The cluster secrets that exist after createMissing, including the ones it would have created in a dry run.
+	// Those held back by the rollout policy or the connectivity check aren't.
+	existing := map[string]struct{}{}
+
+	for _, item := range current.Items {
+		existing[item.Name] = struct{}{}
+	}
+
+	if config.DryRun {
+		for _, name := range result.Created {
+			if name == config.qualify(path.Base(name)) {
+				existing[path.Base(name)] = struct{}{}
+			}
+		}
 	}
 
-	for _, item := range result.Items {
+	now := time.Now()
+
+	var deletions []PendingDeletion
+
+	// The cluster secrets to be deleted by name, to identify their clusters in log lines and events
+	byName := map[string]*corev1.Secret{}
+
+	// The number of cluster secrets managed by this ClusterSet, which maxDeletions is relative to
+	managed := len(current.Items)
+
+	for i := range current.Items {
+		item := current.Items[i]
 		name := item.Name
 
-		if _, desired := desiredClusters[name]; !desired {
-			if dryRun {
-				fmt.Printf("Cluster secert %q deleted successfully (Dry Run)\n", name)
-			} else {
-				// Manage resource
-				err := kubeclient.Delete(context.TODO(), name, metav1.DeleteOptions{})
-				if err != nil {
-					return err
-				}
-
-				fmt.Printf("Cluster secert %q deleted successfully\n", name)
+		byName[name] = &current.Items[i]
+
+		log := log.WithValues(clusterSecretKeysAndValues(&item)...)
+
+		if _, desired := desiredClusters[name]; desired {
+			continue
+		}
+
+		// Other namespaces and remote destinations are shared with other ClusterSets and Argo CD itself,
+		// and contain cluster secrets this ClusterSet never created
+		if !config.local() && item.Annotations[SecretAnnotationKeyClusterSet] != config.owner() {
+			log.V(1).Info("Skipping deletion of cluster secret not owned by this ClusterSet", "owner", item.Annotations[SecretAnnotationKeyClusterSet])
+
+			managed--
+
+			continue
+		}
+
+		if owner, ok := config.ownedByOther(item); ok {
+			log.Info("Skipping deletion of cluster secret owned by another ClusterSet", "owner", owner)
+
+			managed--
+
+			continue
+		}
+
+		// The cluster is still selected, but its credentials couldn't be read this time
+		if _, ok := config.keptServers[serverKey(string(item.Data["server"]))]; ok {
+			log.Info("Keeping cluster secret of cluster whose credentials can't be read")
+
+			continue
+		}
+
+		// The secret for the same server has already been created under the new name by createMissing,
+		// so that Argo CD never loses the cluster while it's being renamed.
+		// The old one is kept until then, when the new one is held back.
+		if newName, ok := desiredServers[serverKey(string(item.Data["server"]))]; ok {
+			if _, created := existing[newName]; !created {
+				log.Info("Keeping cluster secret until the cluster secret under the new name is created", "newSecret", newName)
+
+				continue
+			}
+
+			log.Info("Cluster secret has been renamed", "newSecret", newName)
+
+			deletions = append(deletions, PendingDeletion{Name: name, MissingSince: now})
+
+			continue
+		}
+
+		since, err := markMissing(kubeclient, item, now, config.DryRun)
+		if err != nil {
+			return err
+		}
+
+		if config.Prune.Disabled {
+			log.Info("Keeping cluster secret of missing cluster as pruning is disabled", "missingSince", since.Format(time.RFC3339))
+
+			result.PendingDeletions = append(result.PendingDeletions, PendingDeletion{Name: config.qualify(name), MissingSince: since})
+
+			continue
+		}
+
+		if deadline := since.Add(config.Prune.GracePeriod); now.Before(deadline) {
+			log.Info("Keeping cluster secret of missing cluster until the grace period elapses", "missingSince", since.Format(time.RFC3339), "deleteAfter", deadline.Format(time.RFC3339))
+
+			result.PendingDeletions = append(result.PendingDeletions, PendingDeletion{Name: config.qualify(name), MissingSince: since})
+
+			continue
+		}
+
+		deletions = append(deletions, PendingDeletion{Name: name, MissingSince: since})
+	}
+
+	max, err := config.Prune.maxDeletions(managed)
+	if err != nil {
+		return err
+	}
+
+	if max >= 0 && len(deletions) > max {
+		refused := &PruneRefusedError{Max: max, Total: managed}
+
+		for _, d := range deletions {
+			refused.Deletions = append(refused.Deletions, config.qualify(d.Name))
+
+			result.PendingDeletions = append(result.PendingDeletions, PendingDeletion{Name: config.qualify(d.Name), MissingSince: d.MissingSince})
+		}
+
+		if !config.DryRun {
+			metrics.PruneRefusals.WithLabelValues(config.NS, config.Name).Inc()
+		}
+
+		return refused
+	}
+
+	for _, d := range deletions {
+		name := d.Name
+		secret := byName[name]
+		server := string(secret.Data["server"])
+
+		log := log.WithValues(clusterSecretKeysAndValues(secret)...)
+
+		result.Deleted = append(result.Deleted, config.qualify(name))
+		result.Changes = append(result.Changes, Change{Action: ChangeActionDelete, Name: config.qualify(name), Before: secret})
+
+		if !config.DryRun {
+			// Manage resource
+			err := kubeclient.Delete(context.TODO(), name, metav1.DeleteOptions{})
+			if err != nil {
+				config.observeSecret(metrics.ResultFailed)
+				config.event(corev1.EventTypeWarning, EventReasonClusterFailed, "Failed to delete cluster secret %q for cluster %s: %v", name, server, err)
+
+				return err
 			}
+
+			config.observeSecret(metrics.ResultDeleted)
+			config.event(corev1.EventTypeNormal, EventReasonClusterRemoved, "Deleted cluster secret %q for cluster %s", config.qualify(name), server)
 		}
+
+		log.Info("Deleted cluster secret", "dryRun", config.DryRun)
 	}
 
 	return nil
 }
 
-func Sync(config ClusterSetConfig) error {
-	if err := CreateMissing(config); err != nil {
-		return xerrors.Errorf("creating missing cluster secrets: %w", err)
+// listClusterSecrets returns the cluster secrets managed with the labels
+func listClusterSecrets(kubeclient typedcorev1.SecretInterface, labels map[string]string) (*corev1.SecretList, error) {
+	labelSelectors := []string{
+		fmt.Sprintf("%s=%s", SecretLabelKeyArgoCDType, SecretLabelValueArgoCDCluster),
 	}
 
-	if err := DeleteMissing(config); err != nil {
-		return xerrors.Errorf("deleting redundant cluster secrets: %w", err)
+	for k, v := range labels {
+		labelSelectors = append(labelSelectors, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	return nil
+	current, err := kubeclient.List(context.TODO(), metav1.ListOptions{
+		LabelSelector: strings.Join(labelSelectors, ","),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("listing cluster secrets: %w", err)
+	}
+
+	return current, nil
 }
 
-func clusterSecretsFromClusters(ns string, tags, labels map[string]string) ([]*corev1.Secret, error) {
-	sess := awsclicompat.NewSession("", "")
+// Sync creates missing cluster secrets, updates drifted ones and deletes redundant ones, from the clusters discovered only once.
+// With DryRun, the returned Result reports the changes that would have been made.
+// Each destination is synced independently. When any of them fails, the Result is returned along with the first error,
+// which can be a *PruneRefusedError when the prune policy refuses deletions.
+func Sync(config ClusterSetConfig) (*Result, error) {
+	clientset, err := newClientset(config.log())
+	if err != nil {
+		return nil, xerrors.Errorf("creating clientset: %w", err)
+	}
 
-	eksClient := eks.New(sess)
+	clusters, conflicts, held, err := selectClusters(clientset, config)
+	if err != nil {
+		return nil, err
+	}
 
-	var secrets []*corev1.Secret
+	config.keptServers = held.keptServers
 
-	process := func(nextToken *string) (*string, error) {
-		log.Printf("Calling EKS ListClusters...")
+	for _, c := range conflicts {
+		config.log().Info("Conflict between selectors", "server", c.Server, "clusters", c.Clusters, "message", c.Message)
+	}
 
-		result, err := eksClient.ListClusters(&eks.ListClustersInput{
-			NextToken: nextToken,
-		})
+	if len(held.creating) > 0 {
+		config.log().Info("Waiting for EKS clusters being created", "clusters", held.creating)
+	}
 
-		if err != nil {
-			return nil, xerrors.Errorf("listing clusters: %w", err)
-		}
+	result := &Result{
+		Conflicts:        conflicts,
+		CreatingClusters: held.creating,
+	}
 
-		log.Printf("Found %d clusters.", len(result.Clusters))
+	for _, c := range clusters {
+		result.Clusters = append(result.Clusters, c.SecretName)
+	}
 
-		for _, clusterName := range result.Clusters {
-			log.Printf("Checking cluster %s...", *clusterName)
+	result.SelectedClusters = clusters
 
-			result, err := eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(*clusterName)})
-			if err != nil {
-				return nil, xerrors.Errorf("creating cluster secret: %w", err)
-			}
+	if config.Connectivity.Enabled {
+		config.unreachableClusters = map[string]error{}
 
-			all := true
-			for k, v := range tags {
-				value := result.Cluster.Tags[k]
+		for _, r := range checkConnectivity(config.Connectivity, clusters) {
+			result.Connectivity = append(result.Connectivity, r)
 
-				all = all && value != nil && *value == v
+			if r.Err == nil {
+				continue
 			}
 
-			if all {
-				sec := newClusterSecretFromCluster(ns, *clusterName, labels, result)
+			config.unreachableClusters[r.SecretName] = r.Err
 
-				secrets = append(secrets, sec)
-			} else {
-				log.Printf("Cluster %s with tags %v did not match selector %v", *clusterName, result.Cluster.Tags, tags)
-			}
+			config.log().Info("Cluster is unreachable", "secret", r.SecretName, "server", r.Server, "reason", r.Err.Error())
+			config.event(corev1.EventTypeWarning, EventReasonClusterUnreachable, "Cluster %s of cluster secret %q is unreachable: %v", r.Server, r.SecretName, r.Err)
 		}
+	}
+
+	var destErr error
+
+	for _, dest := range config.destinations() {
+		dest := dest
 
-		return result.NextToken, nil
+		target := config
+		target.destination = &dest
+
+		err := syncDestination(clientset, target, clusters, result)
+
+		result.Destinations = append(result.Destinations, DestinationResult{Destination: dest, Err: err})
+
+		// Keep syncing the other destinations, so that an unreachable Argo CD instance doesn't block others
+		if err != nil && destErr == nil {
+			destErr = xerrors.Errorf("syncing destination %s: %w", dest, err)
+		}
 	}
 
-	log.Printf("Computing desired cluster secrets from EKS clusters...")
+	return result, destErr
+}
 
-	nextToken, err := process(nil)
+// syncDestination syncs the cluster secrets for the clusters in the destination of the config
+func syncDestination(localClientset kubernetes.Interface, config ClusterSetConfig, clusters []Cluster, result *Result) error {
+	clientset, err := destinationClientset(localClientset, config.NS, *config.destination)
 	if err != nil {
-		return nil, xerrors.Errorf("processing first set of EKS clusters: %w", err)
+		return err
 	}
 
-	for nextToken = nil; nextToken != nil; {
-		var err error
+	objects, claimConflicts, err := resolveClaims(clientset.CoreV1().Secrets(config.namespace()), config, newClusterSecrets(config, clusters))
+	if err != nil {
+		return err
+	}
 
-		nextToken, err = process(nextToken)
+	for _, c := range claimConflicts {
+		config.log().Info("Cluster claimed by another ClusterSet", "secret", c.SecretName, "server", c.Server, "owner", c.Owner)
+	}
 
-		if err != nil {
-			return nil, err
+	result.ClaimConflicts = append(result.ClaimConflicts, claimConflicts...)
+
+	if err := createMissing(clientset, config, objects, result); err != nil {
+		return xerrors.Errorf("creating missing cluster secrets: %w", err)
+	}
+
+	if err := deleteMissing(clientset, config, objects, result); err != nil {
+		var refused *PruneRefusedError
+		if xerrors.As(err, &refused) {
+			return err
+		}
+
+		return xerrors.Errorf("deleting redundant cluster secrets: %w", err)
+	}
+
+	return nil
+}
+
+// clusterSecretsFromClusters returns the desired cluster secrets, along with the servers of the selected clusters
+// whose existing cluster secrets are to be kept
+func clusterSecretsFromClusters(clientset kubernetes.Interface, config ClusterSetConfig) ([]*corev1.Secret, []Conflict, map[string]struct{}, error) {
+	clusters, conflicts, held, err := selectClusters(clientset, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, c := range conflicts {
+		config.log().Info("Conflict between selectors", "server", c.Server, "clusters", c.Clusters, "message", c.Message)
+	}
+
+	return newClusterSecrets(config, clusters), conflicts, held.keptServers, nil
+}
+
+func newClusterSecrets(config ClusterSetConfig, clusters []Cluster) []*corev1.Secret {
+	var secrets []*corev1.Secret
+
+	for _, cluster := range clusters {
+		sec := newClusterSecretFromValues(config.namespace(), config.Labels, cluster)
+
+		if config.Name != "" {
+			sec.Annotations[SecretAnnotationKeyClusterSet] = config.owner()
 		}
+
+		secrets = append(secrets, sec)
 	}
 
-	return secrets, nil
+	return secrets
 }
 
 func newClusterSecretFromName(ns, name string, labels map[string]string) (*corev1.Secret, error) {
@@ -305,15 +813,31 @@ func newClusterSecretFromName(ns, name string, labels map[string]string) (*corev
 }
 
 func newClusterSecretFromCluster(ns, name string, labels map[string]string, result *eks.DescribeClusterOutput) *corev1.Secret {
-	return newClusterSecretFromValues(ns, name, labels, *result.Cluster.Endpoint, *result.Cluster.CertificateAuthority.Data)
+	return newClusterSecretFromValues(ns, labels, clusterFromEKS(name, result))
 }
 
 const (
 	SecretLabelKeyArgoCDType      = "argocd.argoproj.io/secret-type"
 	SecretLabelValueArgoCDCluster = "cluster"
+
+	SecretAnnotationKeyClusterName = "clusterset.mumo.co/cluster-name"
+	SecretAnnotationKeyClusterARN  = "clusterset.mumo.co/cluster-arn"
+	SecretAnnotationKeyAWSAccount  = "clusterset.mumo.co/aws-account"
+	SecretAnnotationKeyAWSRegion   = "clusterset.mumo.co/aws-region"
+
+	SecretAnnotationKeyKubernetesVersion = "clusterset.mumo.co/kubernetes-version"
+	SecretAnnotationKeyPlatformVersion   = "clusterset.mumo.co/platform-version"
+	SecretAnnotationKeyCreatedAt         = "clusterset.mumo.co/created-at"
+	SecretAnnotationKeyEndpointAccess    = "clusterset.mumo.co/endpoint-access"
+	SecretAnnotationKeyPublicAccessCIDRs = "clusterset.mumo.co/public-access-cidrs"
+	SecretAnnotationKeyClusterSet        = "clusterset.mumo.co/clusterset"
+	SecretAnnotationKeyMissingSince      = "clusterset.mumo.co/missing-since"
+
+	// SecretAnnotationPrefix is the prefix of all the annotations managed by argocd-clusterset
+	SecretAnnotationPrefix = "clusterset.mumo.co/"
 )
 
-func newClusterSecretFromValues(ns, name string, labels map[string]string, server, base64CA string) *corev1.Secret {
+func newClusterSecretFromValues(ns string, labels map[string]string, cluster Cluster) *corev1.Secret {
 	lbls := map[string]string{
 		SecretLabelKeyArgoCDType: SecretLabelValueArgoCDCluster,
 	}
@@ -322,6 +846,11 @@ func newClusterSecretFromValues(ns, name string, labels map[string]string, serve
 		lbls[k] = v
 	}
 
+	name := cluster.SecretName
+	if name == "" {
+		name = cluster.Name
+	}
+
 	// Create resource object
 	object := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
@@ -329,30 +858,36 @@ func newClusterSecretFromValues(ns, name string, labels map[string]string, serve
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: ns,
-			Labels:    lbls,
+			Name:        name,
+			Namespace:   ns,
+			Labels:      lbls,
+			Annotations: cluster.annotations(),
 		},
 		StringData: map[string]string{
-			"name":   name,
-			"server": server,
-			"config": fmt.Sprintf(`{
-      "awsAuthConfig": {
-        "clusterName": "%s"
-      },
-      "tlsClientConfig": {
-        "insecure": false,
-        "caData": "%s"
-      }
-    }
-`, name, base64CA),
+			"name":   cluster.Name,
+			"server": cluster.Server,
+			"config": argocdClusterConfig(cluster),
 		},
 	}
 
 	return object
 }
 
-func newClientset() (*kubernetes.Clientset, error) {
+func newClientset(log logr.Logger) (*kubernetes.Clientset, error) {
+	config, err := newRestConfig(log)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, xerrors.Errorf("new for config: %w", err)
+	}
+
+	return clientset, nil
+}
+
+func newRestConfig(log logr.Logger) (*rest.Config, error) {
 	var kubeconfig string
 	kubeconfig, ok := os.LookupEnv("KUBECONFIG")
 	if !ok {
@@ -364,7 +899,7 @@ func newClientset() (*kubernetes.Clientset, error) {
 	if info, _ := os.Stat(kubeconfig); info == nil {
 		var err error
 
-		log.Printf("Using in-cluster Kubernetes API client")
+		log.V(1).Info("Using in-cluster Kubernetes API client")
 
 		config, err = rest.InClusterConfig()
 		if err != nil {
@@ -373,7 +908,7 @@ func newClientset() (*kubernetes.Clientset, error) {
 	} else {
 		var err error
 
-		log.Printf("Using kubeconfig-based Kubernetes API client")
+		log.V(1).Info("Using kubeconfig-based Kubernetes API client", "kubeconfig", kubeconfig)
 
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
@@ -381,10 +916,5 @@ func newClientset() (*kubernetes.Clientset, error) {
 		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, xerrors.Errorf("new for config: %w", err)
-	}
-
-	return clientset, nil
+	return config, nil
 }
@@ -0,0 +1,312 @@
+package run
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func clusterSecret(ns, name, server, owner string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+			Labels: map[string]string{
+				SecretLabelKeyArgoCDType: SecretLabelValueArgoCDCluster,
+			},
+		},
+		Data: map[string][]byte{
+			"name":   []byte(name),
+			"server": []byte(server),
+		},
+	}
+
+	if owner != "" {
+		secret.Annotations = map[string]string{SecretAnnotationKeyClusterSet: owner}
+	}
+
+	return secret
+}
+
+func secretNames(t *testing.T, clientset *fake.Clientset, ns string) []string {
+	t.Helper()
+
+	list, err := clientset.CoreV1().Secrets(ns).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("listing secrets: %v", err)
+	}
+
+	var names []string
+
+	for _, s := range list.Items {
+		names = append(names, s.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestDeleteMissing(t *testing.T) {
+	testcases := map[string]struct {
+		destination DestinationConfig
+		secrets     []runtime.Object
+		want        []string
+	}{
+		"own namespace": {
+			destination: DestinationConfig{Namespace: "team-a"},
+			secrets: []runtime.Object{
+				clusterSecret("team-a", "owned", "https://owned", "cs"),
+				clusterSecret("team-a", "unannotated", "https://unannotated", ""),
+			},
+			want: nil,
+		},
+		"shared target namespace": {
+			destination: DestinationConfig{Namespace: "argocd"},
+			secrets: []runtime.Object{
+				clusterSecret("argocd", "owned", "https://owned", "team-a/cs"),
+				clusterSecret("argocd", "unannotated", "https://unannotated", ""),
+				clusterSecret("argocd", "foreign", "https://foreign", "team-b/other"),
+				clusterSecret("argocd", "same-name", "https://same-name", "cs"),
+			},
+			want: []string{"foreign", "same-name", "unannotated"},
+		},
+		"remote destination": {
+			destination: DestinationConfig{Namespace: "team-a", KubeconfigSecretName: "mgmt"},
+			secrets: []runtime.Object{
+				clusterSecret("team-a", "owned", "https://owned", "team-a/cs"),
+				clusterSecret("team-a", "unannotated", "https://unannotated", ""),
+				clusterSecret("team-a", "foreign", "https://foreign", "team-b/other"),
+				clusterSecret("team-a", "same-name", "https://same-name", "cs"),
+			},
+			want: []string{"foreign", "same-name", "unannotated"},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.secrets...)
+
+			dest := tc.destination
+
+			config := ClusterSetConfig{
+				NS:          "team-a",
+				Name:        "cs",
+				destination: &dest,
+			}
+
+			var result Result
+
+			if err := deleteMissing(clientset, config, nil, &result); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := secretNames(t, clientset, dest.Namespace)
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("unexpected secrets: want %v, got %v", tc.want, got)
+			}
+
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("unexpected secrets: want %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteMissingRenamed(t *testing.T) {
+	renamed := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "argocd", Name: "new"},
+		StringData: map[string]string{"server": "https://cluster"},
+	}
+
+	testcases := map[string]struct {
+		secrets []runtime.Object
+		want    []string
+	}{
+		"created": {
+			secrets: []runtime.Object{
+				clusterSecret("argocd", "old", "https://cluster", "cs"),
+				clusterSecret("argocd", "new", "https://cluster", "cs"),
+			},
+			want: []string{"new"},
+		},
+		"held back": {
+			secrets: []runtime.Object{
+				clusterSecret("argocd", "old", "https://cluster", "cs"),
+			},
+			want: []string{"old"},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.secrets...)
+
+			config := ClusterSetConfig{
+				NS:          "argocd",
+				Name:        "cs",
+				destination: &DestinationConfig{Namespace: "argocd"},
+			}
+
+			var result Result
+
+			if err := deleteMissing(clientset, config, []*corev1.Secret{renamed}, &result); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := secretNames(t, clientset, "argocd")
+
+			if len(got) != len(tc.want) || got[0] != tc.want[0] {
+				t.Errorf("unexpected secrets: want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDeleteMissingMaxDeletionsExcludesOthers(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		clusterSecret("argocd", "missing-1", "https://missing-1", "cs"),
+		clusterSecret("argocd", "missing-2", "https://missing-2", "cs"),
+		clusterSecret("argocd", "foreign-1", "https://foreign-1", "other"),
+		clusterSecret("argocd", "foreign-2", "https://foreign-2", "other"),
+	)
+
+	maxDeletions := intstr.FromString("50%")
+
+	config := ClusterSetConfig{
+		NS:          "argocd",
+		Name:        "cs",
+		ClusterSets: map[string]int32{"argocd/cs": 0, "argocd/other": 0},
+		Prune:       PruneConfig{MaxDeletions: &maxDeletions},
+		destination: &DestinationConfig{Namespace: "argocd"},
+	}
+
+	var result Result
+
+	// 2 deletions out of the 2 cluster secrets of this ClusterSet exceed 50%, even though they don't out of all the 4
+	err := deleteMissing(clientset, config, nil, &result)
+
+	refused, ok := err.(*PruneRefusedError)
+	if !ok {
+		t.Fatalf("expected PruneRefusedError, got %v", err)
+	}
+
+	if refused.Total != 2 || refused.Max != 1 {
+		t.Errorf("unexpected max deletions: %v", refused)
+	}
+
+	if got := secretNames(t, clientset, "argocd"); len(got) != 4 {
+		t.Errorf("expected no cluster secret to be deleted, got %v", got)
+	}
+}
+
+func TestDeleteMissingKeepsUnreadableClusters(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		clusterSecret("argocd", "kept", "https://kept", "cs"),
+		clusterSecret("argocd", "missing", "https://missing", "cs"),
+	)
+
+	config := ClusterSetConfig{
+		NS:          "argocd",
+		Name:        "cs",
+		destination: &DestinationConfig{Namespace: "argocd"},
+		keptServers: map[string]struct{}{serverKey("https://kept"): {}},
+	}
+
+	var result Result
+
+	if err := deleteMissing(clientset, config, nil, &result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := secretNames(t, clientset, "argocd"); len(got) != 1 || got[0] != "kept" {
+		t.Errorf("expected only the cluster secret of the kept cluster to remain, got %v", got)
+	}
+}
+
+func TestCreateMissingRollout(t *testing.T) {
+	desired := func(ns string, names ...string) []*corev1.Secret {
+		var objects []*corev1.Secret
+
+		for _, name := range names {
+			objects = append(objects, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+				StringData: map[string]string{"server": "https://" + name},
+			})
+		}
+
+		return objects
+	}
+
+	testcases := map[string]struct {
+		names   []string
+		secrets []runtime.Object
+		created []string
+		want    []string
+		pending []string
+	}{
+		"counted once across destinations": {
+			names: []string{"renamed", "new-1", "new-2"},
+			secrets: []runtime.Object{
+				clusterSecret("argocd-a", "old", "https://renamed", "cs"),
+				clusterSecret("argocd-b", "old", "https://renamed", "argocd-a/cs"),
+				clusterSecret("argocd-a", "new-1", "https://new-1", "cs"),
+			},
+			created: []string{"renamed", "new-2", "argocd-b/renamed", "argocd-b/new-2"},
+			want:    []string{"new-2", "argocd-b/new-2"},
+			pending: []string{"argocd-b/new-1"},
+		},
+		"renamed only": {
+			names: []string{"renamed"},
+			secrets: []runtime.Object{
+				clusterSecret("argocd-a", "old", "https://renamed", "cs"),
+				clusterSecret("argocd-b", "old", "https://renamed", "argocd-a/cs"),
+			},
+			created: []string{"renamed", "argocd-b/renamed"},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.secrets...)
+
+			var result Result
+
+			for _, ns := range []string{"argocd-a", "argocd-b"} {
+				config := ClusterSetConfig{
+					NS:          "argocd-a",
+					Name:        "cs",
+					Rollout:     RolloutConfig{MaxNewClusters: 1, Interval: time.Hour},
+					destination: &DestinationConfig{Namespace: ns},
+				}
+
+				if err := createMissing(clientset, config, desired(ns, tc.names...), &result); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if !reflect.DeepEqual(result.Created, tc.created) {
+				t.Errorf("unexpected created cluster secrets: want %v, got %v", tc.created, result.Created)
+			}
+
+			if !reflect.DeepEqual(result.NewClusters, tc.want) {
+				t.Errorf("unexpected new clusters: want %v, got %v", tc.want, result.NewClusters)
+			}
+
+			if !reflect.DeepEqual(result.PendingCreations, tc.pending) {
+				t.Errorf("unexpected pending creations: want %v, got %v", tc.pending, result.PendingCreations)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package run
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// updateExisting updates the existing cluster secret to match the desired one, so that the cluster metadata
+// recorded on the secret are refreshed on every sync.
+// It returns the updated secret and true when the secret had drifted and has been updated, or would have been with dryRun.
+func updateExisting(kubeclient typedcorev1.SecretInterface, current, desired *corev1.Secret, dryRun bool) (*corev1.Secret, bool, error) {
+	updated, changed := mergeClusterSecret(current, desired)
+	if !changed || dryRun {
+		return updated, changed, nil
+	}
+
+	if _, err := kubeclient.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		return nil, false, xerrors.Errorf("updating cluster secret %q: %w", desired.Name, err)
+	}
+
+	return updated, true, nil
+}
+
+// mergeClusterSecret returns a copy of the current secret with the labels, annotations and data of the desired secret.
+// Labels and annotations added by others are kept, except for stale annotations managed by argocd-clusterset.
+// The ownership annotation is never removed, so that syncing without a ClusterSet name doesn't orphan the secret.
+func mergeClusterSecret(current, desired *corev1.Secret) (*corev1.Secret, bool) {
+	updated := current.DeepCopy()
+	changed := false
+
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+
+	for k, v := range desired.Labels {
+		if cur, ok := updated.Labels[k]; !ok || cur != v {
+			updated.Labels[k] = v
+			changed = true
+		}
+	}
+
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+
+	for k := range updated.Annotations {
+		if k == SecretAnnotationKeyClusterSet {
+			continue
+		}
+
+		if _, ok := desired.Annotations[k]; !ok && strings.HasPrefix(k, SecretAnnotationPrefix) {
+			delete(updated.Annotations, k)
+			changed = true
+		}
+	}
+
+	for k, v := range desired.Annotations {
+		if cur, ok := updated.Annotations[k]; !ok || cur != v {
+			updated.Annotations[k] = v
+			changed = true
+		}
+	}
+
+	if updated.Data == nil {
+		updated.Data = map[string][]byte{}
+	}
+
+	for k, v := range desired.StringData {
+		if cur, ok := updated.Data[k]; !ok || string(cur) != v {
+			updated.Data[k] = []byte(v)
+			changed = true
+		}
+	}
+
+	return updated, changed
+}
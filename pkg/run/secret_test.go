@@ -0,0 +1,74 @@
+package run
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeClusterSecret(t *testing.T) {
+	current := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "prod-1",
+			Annotations: map[string]string{
+				SecretAnnotationKeyClusterSet:   "prod",
+				SecretAnnotationKeyMissingSince: "2020-11-01T00:00:00Z",
+				SecretAnnotationKeyAWSRegion:    "us-east-2",
+				"example.com/note":              "kept",
+			},
+		},
+		Data: map[string][]byte{"server": []byte("https://prod-1")},
+	}
+
+	testcases := map[string]struct {
+		desired map[string]string
+		want    map[string]string
+	}{
+		"owned": {
+			desired: map[string]string{
+				SecretAnnotationKeyClusterSet: "prod",
+				SecretAnnotationKeyAWSRegion:  "us-east-2",
+			},
+			want: map[string]string{
+				SecretAnnotationKeyClusterSet: "prod",
+				SecretAnnotationKeyAWSRegion:  "us-east-2",
+				"example.com/note":            "kept",
+			},
+		},
+		"synced without a ClusterSet name": {
+			desired: map[string]string{
+				SecretAnnotationKeyAWSRegion: "us-east-2",
+			},
+			want: map[string]string{
+				SecretAnnotationKeyClusterSet: "prod",
+				SecretAnnotationKeyAWSRegion:  "us-east-2",
+				"example.com/note":            "kept",
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			desired := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "prod-1", Annotations: tc.desired},
+				StringData: map[string]string{"server": "https://prod-1"},
+			}
+
+			updated, changed := mergeClusterSecret(current, desired)
+
+			if !changed {
+				t.Errorf("expected the stale annotation to be removed")
+			}
+
+			if !reflect.DeepEqual(updated.Annotations, tc.want) {
+				t.Errorf("unexpected annotations: want %v, got %v", tc.want, updated.Annotations)
+			}
+
+			if _, ok := current.Annotations[SecretAnnotationKeyMissingSince]; !ok {
+				t.Errorf("expected the current secret to be left unmodified")
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mumoshu/argocd-clusterset/pkg/metrics"
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ProviderEKS     = "eks"
+	ProviderHTTP    = "http"
+	ProviderOCM     = "ocm"
+	ProviderKarmada = "karmada"
+)
+
+// Conflict describes clusters that two or more selectors disagreed on.
+// Only the cluster selected first is synced.
+type Conflict struct {
+	Server   string
+	Clusters []string
+	Message  string
+}
+
+// heldClusters are the selected clusters that no cluster secret is rendered for in the sync
+type heldClusters struct {
+	// creating is the names of the EKS clusters being created
+	creating []string
+	// keptServers is the servers of the clusters whose credentials can't be read, by serverKey.
+	// Their existing cluster secrets are kept as they are.
+	keptServers map[string]struct{}
+}
+
+// selectClusters returns the union of the clusters selected by the selectors minus the excluded ones,
+// de-duplicated by the API server URL, along with the selected clusters held back.
+func selectClusters(clientset kubernetes.Interface, config ClusterSetConfig) ([]Cluster, []Conflict, heldClusters, error) {
+	var held heldClusters
+
+	selectors := config.Selectors
+	if len(selectors) == 0 {
+		selectors = []SelectorConfig{{}}
+	}
+
+	var (
+		selected []Cluster
+		creating []Cluster
+		kept     []Cluster
+	)
+
+	for i, sel := range selectors {
+		clusters, err := discoverClusters(clientset, config, sel)
+		if err != nil {
+			return nil, nil, held, xerrors.Errorf("selector %d: %w", i, err)
+		}
+
+		for j := range clusters {
+			clusters[j].Selector = fmt.Sprintf("%d:%s", i, sel)
+
+			switch {
+			case clusters[j].Creating:
+				creating = append(creating, clusters[j])
+			case clusters[j].KeepExisting:
+				kept = append(kept, clusters[j])
+			default:
+				selected = append(selected, clusters[j])
+			}
+		}
+	}
+
+	if config.Exclude != nil {
+		excluded, err := discoverClusters(clientset, config, *config.Exclude)
+		if err != nil {
+			return nil, nil, held, xerrors.Errorf("exclude: %w", err)
+		}
+
+		excludedServers := map[string]struct{}{}
+		excludedCreating := map[string]struct{}{}
+
+		for _, c := range excluded {
+			if c.Creating {
+				excludedCreating[c.ARN] = struct{}{}
+			} else {
+				excludedServers[serverKey(c.Server)] = struct{}{}
+			}
+		}
+
+		var remainingCreating []Cluster
+
+		for _, c := range creating {
+			if _, ok := excludedCreating[c.ARN]; !ok {
+				remainingCreating = append(remainingCreating, c)
+			}
+		}
+
+		creating = remainingCreating
+
+		var remainingKept []Cluster
+
+		for _, c := range kept {
+			if _, ok := excludedServers[serverKey(c.Server)]; !ok {
+				remainingKept = append(remainingKept, c)
+			}
+		}
+
+		kept = remainingKept
+
+		var remaining []Cluster
+
+		for _, c := range selected {
+			if _, ok := excludedServers[serverKey(c.Server)]; ok {
+				config.log().Info("Excluding cluster", "cluster", c.Name, "server", c.Server)
+
+				continue
+			}
+
+			remaining = append(remaining, c)
+		}
+
+		selected = remaining
+	}
+
+	selected, err := applyEndpointAccess(config, selected)
+	if err != nil {
+		return nil, nil, held, err
+	}
+
+	for i := range selected {
+		name, err := secretName(config.NameStrategy, config.NamePrefix, selected[i])
+		if err != nil {
+			return nil, nil, held, err
+		}
+
+		selected[i].SecretName = name
+	}
+
+	clusters, conflicts := dedupeClusters(selected)
+
+	// The same cluster being created can be selected by more than one selector
+	seen := map[string]struct{}{}
+
+	for _, c := range creating {
+		if _, ok := seen[c.ARN]; ok {
+			continue
+		}
+
+		seen[c.ARN] = struct{}{}
+
+		held.creating = append(held.creating, c.Name)
+	}
+
+	for _, c := range kept {
+		if held.keptServers == nil {
+			held.keptServers = map[string]struct{}{}
+		}
+
+		held.keptServers[serverKey(c.Server)] = struct{}{}
+	}
+
+	return clusters, conflicts, held, nil
+}
+
+// discoverClusters returns the clusters selected by the selector, from the provider fixture when set
+func discoverClusters(clientset kubernetes.Interface, config ClusterSetConfig, sel SelectorConfig) ([]Cluster, error) {
+	var (
+		clusters []Cluster
+		err      error
+	)
+
+	if config.Fixture != nil {
+		config.log().Info("Discovering clusters from provider fixture", "provider", sel.provider())
+
+		clusters = fixtureClusters(config.Fixture, sel)
+	} else {
+		clusters, err = discoverProviderClusters(clientset, config, sel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range clusters {
+		clusters[i].Provider = sel.provider()
+	}
+
+	return clusters, nil
+}
+
+func discoverProviderClusters(clientset kubernetes.Interface, config ClusterSetConfig, sel SelectorConfig) ([]Cluster, error) {
+	ns := config.NS
+	log := config.log()
+
+	switch sel.provider() {
+	case ProviderHTTP:
+		log.Info("Discovering clusters from HTTP API", "url", sel.HTTP.URL)
+
+		defer observeDiscovery(ProviderHTTP, "", "", time.Now())
+
+		return httpClusters(log, clientset, ns, *sel.HTTP)
+	case ProviderOCM:
+		log.Info("Discovering clusters from OCM ManagedClusters")
+
+		defer observeDiscovery(ProviderOCM, "", "", time.Now())
+
+		return ocmClusters(log, clientset, ns, *sel.OCM)
+	case ProviderKarmada:
+		log.Info("Discovering clusters from Karmada Clusters")
+
+		defer observeDiscovery(ProviderKarmada, "", "", time.Now())
+
+		return karmadaClusters(log, clientset, ns, *sel.Karmada)
+	default:
+		log.Info("Discovering clusters from EKS", "region", sel.EKSRegion, "roleARN", sel.EKSRoleARN)
+
+		return eksClusters(log, sel, config.Cache, config.Throttle)
+	}
+}
+
+// observeDiscovery records the time taken to discover clusters from the provider since start
+func observeDiscovery(provider, account, region string, start time.Time) {
+	metrics.DiscoveryDuration.WithLabelValues(provider, account, region).Observe(time.Since(start).Seconds())
+}
+
+// dedupeClusters removes clusters whose server or secret name is already taken by a preceding cluster.
+// It is a conflict when the two clusters differ in anything other than labels.
+func dedupeClusters(clusters []Cluster) ([]Cluster, []Conflict) {
+	var (
+		result    []Cluster
+		conflicts []Conflict
+	)
+
+	byServer := map[string]int{}
+	bySecretName := map[string]int{}
+
+	for _, c := range clusters {
+		if i, ok := byServer[serverKey(c.Server)]; ok {
+			if prev := result[i]; !sameCluster(prev, c) {
+				conflicts = append(conflicts, Conflict{
+					Server:   c.Server,
+					Clusters: []string{prev.Name, c.Name},
+					Message:  fmt.Sprintf("cluster %q and %q have the same server %s but differ in name or credentials. Using %q", prev.Name, c.Name, c.Server, prev.Name),
+				})
+			}
+
+			continue
+		}
+
+		if i, ok := bySecretName[c.SecretName]; ok {
+			prev := result[i]
+
+			conflicts = append(conflicts, Conflict{
+				Server:   c.Server,
+				Clusters: []string{prev.Name, c.Name},
+				Message:  fmt.Sprintf("cluster secret %q is desired for both %s and %s. Using %s. Consider changing the name strategy", c.SecretName, prev.Server, c.Server, prev.Server),
+			})
+
+			continue
+		}
+
+		byServer[serverKey(c.Server)] = len(result)
+		bySecretName[c.SecretName] = len(result)
+
+		result = append(result, c)
+	}
+
+	return result, conflicts
+}
+
+func sameCluster(a, b Cluster) bool {
+	return a.Name == b.Name &&
+		a.CAData == b.CAData &&
+		a.AWSClusterName == b.AWSClusterName &&
+		a.AWSRoleARN == b.AWSRoleARN &&
+		a.BearerToken == b.BearerToken &&
+		a.Insecure == b.Insecure
+}
+
+func serverKey(server string) string {
+	return strings.TrimSuffix(strings.ToLower(server), "/")
+}
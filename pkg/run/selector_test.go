@@ -0,0 +1,64 @@
+package run
+
+import (
+	"testing"
+)
+
+func TestSelectClustersCreating(t *testing.T) {
+	fixture := []Cluster{
+		{Name: "prod-1", Server: "https://prod-1", ARN: "arn:aws:eks:us-east-2:123456789012:cluster/prod-1", AWSRegion: "us-east-2", Provider: ProviderEKS},
+		{Name: "prod-2", ARN: "arn:aws:eks:us-east-2:123456789012:cluster/prod-2", AWSRegion: "us-east-2", Provider: ProviderEKS, Creating: true},
+		{Name: "prod-3", ARN: "arn:aws:eks:us-east-2:123456789012:cluster/prod-3", AWSRegion: "us-east-2", Provider: ProviderEKS, Creating: true, Labels: map[string]string{"skip": "true"}},
+	}
+
+	config := ClusterSetConfig{
+		NS:           "argocd",
+		Name:         "prod",
+		NameStrategy: "plain",
+		Fixture:      fixture,
+		// Both the selectors select the clusters being created
+		Selectors: []SelectorConfig{{EKSRegion: "us-east-2"}, {}},
+		Exclude:   &SelectorConfig{EKSTags: map[string]string{"skip": "true"}},
+	}
+
+	clusters, _, held, err := selectClusters(nil, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(clusters) != 1 || clusters[0].Name != "prod-1" {
+		t.Errorf("expected only the active cluster to be selected, got %v", clusters)
+	}
+
+	if len(held.creating) != 1 || held.creating[0] != "prod-2" {
+		t.Errorf("expected the selected cluster being created to be returned once, got %v", held.creating)
+	}
+}
+
+func TestSelectClustersKeepExisting(t *testing.T) {
+	config := ClusterSetConfig{
+		NS:           "argocd",
+		Name:         "hub",
+		NameStrategy: "plain",
+		Fixture: []Cluster{
+			{Name: "a", Server: "https://a", Provider: ProviderKarmada},
+			{Name: "b", Server: "https://b", Provider: ProviderKarmada, KeepExisting: true},
+			{Name: "c", Server: "https://c", Provider: ProviderKarmada, KeepExisting: true, Labels: map[string]string{"skip": "true"}},
+		},
+		Selectors: []SelectorConfig{{Karmada: &KarmadaConfig{}}},
+		Exclude:   &SelectorConfig{Karmada: &KarmadaConfig{MatchLabels: map[string]string{"skip": "true"}}},
+	}
+
+	clusters, _, held, err := selectClusters(nil, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(clusters) != 1 || clusters[0].Name != "a" {
+		t.Errorf("expected only the cluster with credentials to be selected, got %v", clusters)
+	}
+
+	if _, ok := held.keptServers[serverKey("https://b")]; !ok || len(held.keptServers) != 1 {
+		t.Errorf("expected only the selected cluster without credentials to be kept, got %v", held.keptServers)
+	}
+}